@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	s "strings"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -17,60 +21,182 @@ import (
 	"github.com/ponbac/majority-wins/game"
 )
 
-// Holds all rooms, key = room ID, value = room pointer
-var rooms = map[string]*game.Room{}
+// Holds all rooms
+var rooms = game.NewManager(game.DefaultIdleTTL, game.DefaultFinishedTTL)
+
+// Available question providers, selectable with the providers param on /new
+var providers = data.DefaultRegistry(packsDir())
 
 func createRoom(c echo.Context) error {
 	name := c.QueryParam("name")
-	var roomID string
-	for ok := true; ok; _, ok = rooms[roomID] {
-		roomID = randomString(4)
-	}
-
-	room := game.NewRoom(roomID)
-	rooms[roomID] = room
-	room.Questions = fetchOpenTDBQuestions()
-	room.Questions = append(room.Questions, fetchTTAQuestions()...)
-	nQuestions := c.QueryParam("questions")
-	if nQuestions != "" {
-		n, err := strconv.Atoi(nQuestions)
-		if err != nil {
-			log.Error().Err(err).Msg("Could not convert questions param to int")
-		} else {
-			room.NQuestions = n
+
+	update, err := parseSettings(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	settings, err := game.DefaultSettings().Apply(update)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	source := &data.Source{Registry: providers}
+	if err := source.Validate(settings); err != nil {
+		if errors.Is(err, data.ErrUnknownProvider) || errors.Is(err, data.ErrPackNotFound) {
+			return c.String(http.StatusNotFound, err.Error())
 		}
+		return c.String(http.StatusBadRequest, err.Error())
 	}
-	go room.Run()
-	log.Debug().Msg("Room [" + roomID + "]: Created")
-	err := game.ServeWs(room, true, name, c.Response(), c.Request())
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), game.FetchTimeout)
+	defer cancel()
+	questions, err := source.FetchQuestions(ctx, settings)
 	if err != nil {
+		if errors.Is(err, data.ErrUnknownProvider) || errors.Is(err, data.ErrPackNotFound) {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		return c.String(http.StatusBadGateway, err.Error())
+	}
+
+	password := c.QueryParam("password")
+	room := rooms.Create(func(room *game.Room) {
+		room.SetPassword(password)
+		room.Settings = settings
+		room.SetupTeams(settings.Teams)
+		room.Source = source
+		room.Questions = questions
+	})
+	roomID := room.ID
+	log.Debug().Msg("Room [" + roomID + "]: Playing in " + settings.Mode.String() + " mode")
+	err = game.ServeWs(room, true, name, "", c.Response(), c.Request())
+	if err != nil {
+		rooms.Delete(roomID)
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
 	return c.String(http.StatusOK, "Created room "+roomID)
 }
 
-func joinRoom(c echo.Context) error {
-	// Prevent user to join finished room
-	deleteFinishedRooms()
+// parseSettings reads the initial room settings from the /new query params.
+func parseSettings(c echo.Context) (*game.JSONSettings, error) {
+	update := &game.JSONSettings{}
+	for param, field := range map[string]**int{
+		"questions":    &update.Questions,
+		"time":         &update.AnswerTime,
+		"results_time": &update.ResultsTime,
+		"max_players":  &update.MaxPlayers,
+		"teams":        &update.Teams,
+		"lives":        &update.Lives,
+	} {
+		if value := c.QueryParam(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errors.New("invalid " + param + " param " + value)
+			}
+			*field = &n
+		}
+	}
+	for param, field := range map[string]**string{
+		"mode":        &update.Mode,
+		"tie":         &update.Tie,
+		"difficulty":  &update.Difficulty,
+		"providers":   &update.Providers,
+		"team_answer": &update.TeamAnswer,
+		"estimate":    &update.Estimate,
+	} {
+		if value := c.QueryParam(param); value != "" {
+			*field = &value
+		}
+	}
+	if finalWager := c.QueryParam("final_wager"); finalWager != "" {
+		b, err := strconv.ParseBool(finalWager)
+		if err != nil {
+			return nil, errors.New("invalid final_wager param " + finalWager)
+		}
+		update.FinalWager = &b
+	}
+	if pack := c.QueryParam("pack"); pack != "" && update.Providers == nil {
+		providers := "pack/" + pack
+		update.Providers = &providers
+	}
+	if categories := c.QueryParam("categories"); categories != "" {
+		list := s.Split(categories, ",")
+		update.Categories = &list
+	}
+	if scoring := c.QueryParam("scoring"); scoring != "" {
+		rules := s.Split(scoring, ",")
+		update.Scoring = &rules
+	}
+	// Per question type answer times, e.g. type_time=VS:20,Challenge:30
+	if typeTimes := c.QueryParam("type_time"); typeTimes != "" {
+		byType := make(map[string]int)
+		for _, typeTime := range s.Split(typeTimes, ",") {
+			i := s.LastIndex(typeTime, ":")
+			if i < 0 {
+				return nil, errors.New("invalid type_time param " + typeTime)
+			}
+			seconds, err := strconv.Atoi(typeTime[i+1:])
+			if err != nil {
+				return nil, errors.New("invalid type_time param " + typeTime)
+			}
+			byType[typeTime[:i]] = seconds
+		}
+		update.AnswerTimeByType = &byType
+	}
+	return update, nil
+}
 
-	// Check if room exists
+func joinRoom(c echo.Context) error {
+	// Check if room exists, and prevent user to join finished room unless reconnecting
 	roomID := c.QueryParam("room")
-	if _, ok := rooms[roomID]; !ok {
+	session := c.QueryParam("session")
+	room, ok := rooms.Get(roomID)
+	if !ok || (room.IsFinished() && session == "") {
 		return c.String(http.StatusNotFound, "Room "+roomID+" not found")
 	}
+	// A valid session is enough to reconnect, new players need the password
+	if session == "" && !room.CheckPassword(c.QueryParam("password")) {
+		return c.String(http.StatusForbidden, "Wrong password for room "+roomID)
+	}
 
 	name := s.TrimSpace(c.QueryParam("name"))
-	room := rooms[roomID]
-	err := game.ServeWs(room, false, name, c.Response(), c.Request())
-	if err != nil {
-		// Most probably non unique name used
+	err := game.ServeWs(room, false, name, session, c.Response(), c.Request())
+	switch {
+	case errors.Is(err, game.ErrInvalidSession), errors.Is(err, game.ErrBanned):
+		return c.String(http.StatusForbidden, err.Error())
+	case errors.Is(err, game.ErrRoomFull), errors.Is(err, game.ErrNameTaken):
+		return c.String(http.StatusConflict, err.Error())
+	case errors.Is(err, game.ErrRoomClosed):
+		return c.String(http.StatusNotFound, "Room "+roomID+" not found")
+	case err != nil:
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
 	return c.String(http.StatusOK, "Joined room "+roomID)
 }
 
+// watchRoom connects a spectator, e.g. a TV showing the questions, that can not play.
+// view=presentation adds the timer and vote data needed to present the game on a big screen.
+func watchRoom(c echo.Context) error {
+	roomID := c.QueryParam("room")
+	room, ok := rooms.Get(roomID)
+	if !ok {
+		return c.String(http.StatusNotFound, "Room "+roomID+" not found")
+	}
+	if !room.CheckPassword(c.QueryParam("password")) {
+		return c.String(http.StatusForbidden, "Wrong password for room "+roomID)
+	}
+
+	presentation := c.QueryParam("view") == "presentation"
+	err := game.ServeWatch(room, presentation, c.Response(), c.Request())
+	switch {
+	case errors.Is(err, game.ErrRoomClosed):
+		return c.String(http.StatusNotFound, "Room "+roomID+" not found")
+	case err != nil:
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.String(http.StatusOK, "Watching room "+roomID)
+}
+
 func index(c echo.Context) error {
 	c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -79,6 +205,7 @@ func index(c echo.Context) error {
 
 func main() {
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	rand.Seed(time.Now().UnixNano())
 
 	e := echo.New()
 
@@ -94,50 +221,37 @@ func main() {
 	e.GET("/", index)
 	e.GET("/new", createRoom)
 	e.GET("/join", joinRoom)
+	e.GET("/watch", watchRoom)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Info().Msg("No port specified, defaulting to 8080")
 		port = "8080"
 	}
-	e.Logger.Fatal(e.Start(":" + port))
-}
-
-func fetchOpenTDBQuestions() []*game.Question {
-	openTdb := &data.Provider{
-		Name: "OpenTDB",
-		Path: "https://opentdb.com/api.php?amount=20",
-		Type: data.None,
-		Key:  "",
-	}
-
-	return openTdb.FetchQuestions()
-}
 
-func fetchTTAQuestions() []*game.Question {
-	return data.TtaProvider.FetchQuestions()
-}
-
-// TODO: This does not work?
-func deleteFinishedRooms() {
-	for roomID, room := range rooms {
-		if !room.Active {
-			log.Debug().Msg("Deleted room [" + roomID + "]")
-			delete(rooms, roomID)
-		} else {
-			log.Debug().Msg("Room [" + roomID + "]: Active")
+	rooms.StartReaper()
+	go func() {
+		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
 		}
+	}()
+
+	// Shut down gracefully, closing every room, on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Info().Msg("Shutting down...")
+	rooms.Shutdown()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Fatal(err)
 	}
 }
 
-func randomString(n int) string {
-	rand.Seed(time.Now().UnixNano())
-
-	var letters = []rune("ABCDEFGHJKLMNPQRSTUVWXYZ123456789")
-
-	s := make([]rune, n)
-	for i := range s {
-		s[i] = letters[rand.Intn(len(letters))]
+func packsDir() string {
+	if dir := os.Getenv("PACKS_DIR"); dir != "" {
+		return dir
 	}
-	return string(s)
+	return data.DefaultPacksDir
 }
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ponbac/majority-wins/game"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Default location of the bundled question pack, relative to the working directory.
+	DefaultQuestionsPath = "./questions.json"
+	// Default directory holding additional question packs.
+	DefaultPacksDir = "./packs"
+)
+
+var ErrPackNotFound = errors.New("question pack not found")
+
+// LocalProvider loads questions from a pack file, or from every pack file in a directory.
+type LocalProvider struct {
+	Name string
+	Path string
+}
+
+type localPack struct {
+	Questions []*localQuestion `json:"questions"`
+}
+
+type localQuestion struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Choices     []string `json:"choices"`
+	Reward      int      `json:"reward"`
+	// Questions without choices but with an answer are free text questions
+	Answer  string   `json:"answer"`
+	Aliases []string `json:"aliases"`
+	// Questions with a number as the answer are numeric estimation questions
+	Number *float64 `json:"number"`
+	// Players stake points on wager questions before they are shown
+	Wager bool `json:"wager"`
+	// Questions with an answer and bluff set are answered by voting among the players' bluffs
+	Bluff bool `json:"bluff"`
+}
+
+// LoadQuestions reads a question pack in the questions.json format.
+func LoadQuestions(path string) ([]*game.Question, error) {
+	bodyBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pack localPack
+	err = json.Unmarshal(bodyBytes, &pack)
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []*game.Question
+	for _, lQuestion := range pack.Questions {
+		questions = append(questions, lQuestion.toQuestion())
+	}
+
+	log.Debug().Msgf("Loaded %d questions from %s", len(questions), path)
+	return questions, nil
+}
+
+// NewLocalProvider resolves a pack name inside packsDir. An empty name selects the
+// bundled questions.json, a directory name selects every pack in that directory.
+func NewLocalProvider(packsDir string, pack string) (*LocalProvider, error) {
+	if pack == "" {
+		return &LocalProvider{Name: "Local", Path: DefaultQuestionsPath}, nil
+	}
+	if pack != filepath.Base(pack) || strings.HasPrefix(pack, ".") {
+		return nil, ErrPackNotFound
+	}
+
+	candidates := []string{filepath.Join(packsDir, pack)}
+	if filepath.Ext(pack) != ".json" {
+		candidates = append(candidates, filepath.Join(packsDir, pack+".json"))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return &LocalProvider{Name: "Local (" + pack + ")", Path: path}, nil
+		}
+	}
+	return nil, ErrPackNotFound
+}
+
+// Load reads every question from the provider's file or directory.
+func (p *LocalProvider) Load() ([]*game.Question, error) {
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return LoadQuestions(p.Path)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(p.Path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var questions []*game.Question
+	for _, path := range paths {
+		packQuestions, err := LoadQuestions(path)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, packQuestions...)
+	}
+	return questions, nil
+}
+
+func (p *LocalProvider) FetchQuestions(ctx context.Context, amount int) ([]*game.Question, error) {
+	questions, err := p.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick a random selection if the pack holds more questions than requested
+	if amount > 0 && amount < len(questions) {
+		rand.Shuffle(len(questions), func(i, j int) { questions[i], questions[j] = questions[j], questions[i] })
+		questions = questions[:amount]
+	}
+
+	log.Debug().Msgf("Fetched %d questions from %s", len(questions), p.Name)
+	return questions, nil
+}
+
+func (q *localQuestion) toQuestion() *game.Question {
+	reward := q.Reward
+	if reward < 1 {
+		reward = 1
+	}
+	choices := make([]string, len(q.Choices))
+	copy(choices, q.Choices)
+
+	question := &game.Question{
+		Category:    q.Type,
+		Type:        q.Type,
+		Reward:      reward,
+		Description: q.Description,
+		Choices:     choices,
+		Answers:     make(map[*game.Player]int),
+		Wager:       q.Wager,
+	}
+	if q.Number != nil {
+		question.Kind = game.NumericQuestion
+		question.Choices = []string{}
+		question.CorrectChoice = strconv.FormatFloat(*q.Number, 'f', -1, 64)
+	} else if q.Bluff && q.Answer != "" {
+		question.Kind = game.BluffQuestion
+		question.Choices = []string{}
+		question.CorrectChoice = q.Answer
+		question.Aliases = append([]string{}, q.Aliases...)
+	} else if len(choices) == 0 && q.Answer != "" {
+		question.Kind = game.FreeTextQuestion
+		question.CorrectChoice = q.Answer
+		question.Aliases = append([]string{}, q.Aliases...)
+	}
+	return question
+}
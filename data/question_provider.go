@@ -1,35 +1,55 @@
 package data
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/ponbac/majority-wins/game"
 	"github.com/rs/zerolog/log"
 )
 
+// Number of questions fetched when a provider is asked for amount <= 0
+const defaultAmount = 20
+
+// QuestionProvider is implemented by every question source.
 type QuestionProvider interface {
-	FetchQuestions(client http.Client) []*game.Question
+	// FetchQuestions returns up to amount questions, or the provider's default amount if amount <= 0.
+	FetchQuestions(ctx context.Context, amount int) ([]*game.Question, error)
 }
 
+var defaultClient = &http.Client{Timeout: time.Second * 10}
+
 type TTAProvider struct {
-	Name string
-	Path string
-	Type QuestionType
-	Key  string
+	Name   string
+	Path   string
+	Type   QuestionType
+	Key    string
+	Client *http.Client
 }
 
 var TtaProvider = &TTAProvider{
 	Name: "Trivia",
-	Path: "https://the-trivia-api.com/api/questions?limit=20",
+	Path: "https://the-trivia-api.com/api/questions",
 	Type: None,
 	Key:  "Trivia",
 }
 
+var TtaTextProvider = &TTAProvider{
+	Name: "Trivia free text",
+	Path: "https://the-trivia-api.com/api/questions",
+	Type: FreeText,
+	Key:  "Trivia",
+}
+
 type ttaQuestion struct {
 	Category         string   `json:"category"`
 	Type             string   `json:"type"`
@@ -39,36 +59,52 @@ type ttaQuestion struct {
 	IncorrectAnswers []string `json:"incorrectAnswers"`
 }
 
-func (p *TTAProvider) FetchQuestions() []*game.Question {
-	// Make request
-	c := http.Client{Timeout: time.Second * 10}
-	resp, err := c.Get(p.Path)
-	if err != nil {
-		log.Error().Err(err).Msg("Could not fetch questions from " + p.Path)
+func (p *TTAProvider) FetchQuestions(ctx context.Context, amount int) ([]*game.Question, error) {
+	if amount <= 0 {
+		amount = defaultAmount
 	}
-	defer resp.Body.Close()
 
-	// Read response in bytes
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Error().Err(err)
-	}
-
-	// Parse response to object
+	// Make request and parse response to object
 	var pQuestions []*ttaQuestion
-	err = json.Unmarshal(bodyBytes, &pQuestions)
+	err := fetchJSON(ctx, p.Client, p.Path+"?"+url.Values{"limit": {strconv.Itoa(amount)}}.Encode(), &pQuestions)
 	if err != nil {
-		log.Error().Err(err)
+		return nil, err
 	}
 
 	// Convert to game.Question
 	var questions []*game.Question
 	for _, pQuestion := range pQuestions {
-		questions = append(questions, pQuestion.toQuestion())
+		questions = append(questions, withType(pQuestion.toQuestion(), p.Type))
 	}
 
 	log.Debug().Msgf("Fetched %d questions from %s", len(questions), p.Name)
-	return questions
+	return questions, nil
+}
+
+// fetchJSON makes a GET request to path and decodes the JSON response into v.
+func fetchJSON(ctx context.Context, client *http.Client, path string, v interface{}) error {
+	if client == nil {
+		client = defaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not fetch questions from %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("could not fetch questions from " + path + ": " + resp.Status)
+	}
+
+	// Read response in bytes
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bodyBytes, v)
 }
 
 func (q *ttaQuestion) toQuestion() *game.Question {
@@ -103,6 +139,7 @@ func (q *ttaQuestion) toQuestion() *game.Question {
 
 	return &game.Question{
 		Category:      q.Category,
+		Difficulty:    q.Difficulty,
 		Type:          q.Type,
 		Reward:        reward,
 		Description:   q.Question,
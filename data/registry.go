@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ponbac/majority-wins/game"
+	"github.com/rs/zerolog/log"
+)
+
+// Prefix of provider names referring to a pack in the registry's packs directory, e.g. "pack/drinking"
+const packPrefix = "pack/"
+
+var ErrUnknownProvider = errors.New("unknown question provider")
+
+// ProviderRequest asks a named provider for an amount of questions, amount <= 0 means the provider's default.
+type ProviderRequest struct {
+	Name   string
+	Amount int
+}
+
+// Registry holds the available question providers keyed by name.
+type Registry struct {
+	PacksDir  string
+	providers map[string]QuestionProvider
+}
+
+func NewRegistry(packsDir string) *Registry {
+	return &Registry{PacksDir: packsDir, providers: make(map[string]QuestionProvider)}
+}
+
+// DefaultRegistry returns a registry with the built-in providers registered.
+func DefaultRegistry(packsDir string) *Registry {
+	r := NewRegistry(packsDir)
+	r.Register("opentdb", OpenTDBProvider)
+	r.Register("trivia", TtaProvider)
+	r.Register("opentdb_text", OpenTDBTextProvider)
+	r.Register("trivia_text", TtaTextProvider)
+	r.Register("local", &LocalProvider{Name: "Local", Path: DefaultQuestionsPath})
+	return r
+}
+
+func (r *Registry) Register(name string, provider QuestionProvider) {
+	r.providers[strings.ToLower(name)] = provider
+}
+
+// Get returns the provider registered as name, ignoring case. Names prefixed with "pack/" are
+// resolved to question packs in the registry's packs directory, the pack name keeps its case
+// as pack files are looked up by it.
+func (r *Registry) Get(name string) (QuestionProvider, error) {
+	lower := strings.ToLower(name)
+	if provider, ok := r.providers[lower]; ok {
+		return provider, nil
+	}
+	if strings.HasPrefix(lower, packPrefix) {
+		return NewLocalProvider(r.PacksDir, name[len(packPrefix):])
+	}
+	return nil, ErrUnknownProvider
+}
+
+// Names returns the names of all registered providers, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FetchAll fetches questions from every requested provider. A failing provider is skipped,
+// an error is only returned if no questions could be fetched at all.
+func (r *Registry) FetchAll(ctx context.Context, requests []ProviderRequest) ([]*game.Question, error) {
+	var questions []*game.Question
+	var lastErr error
+	for _, request := range requests {
+		provider, err := r.Get(request.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, request.Name)
+		}
+		fetched, err := provider.FetchQuestions(ctx, request.Amount)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not fetch questions from " + request.Name)
+			lastErr = err
+			continue
+		}
+		questions = append(questions, fetched...)
+	}
+	if len(questions) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return questions, nil
+}
+
+// ParseProviderRequests parses a comma separated list of providers with optional
+// amounts, e.g. "opentdb:10,trivia,pack/drinking:5".
+func ParseProviderRequests(s string) ([]ProviderRequest, error) {
+	var requests []ProviderRequest
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		request := ProviderRequest{Name: part}
+		if i := strings.LastIndex(part, ":"); i >= 0 {
+			amount, err := strconv.Atoi(part[i+1:])
+			if err != nil || amount < 0 {
+				return nil, errors.New("invalid amount for provider " + part[:i])
+			}
+			request.Name = part[:i]
+			request.Amount = amount
+		}
+		requests = append(requests, request)
+	}
+	if len(requests) == 0 {
+		return nil, errors.New("no question providers given")
+	}
+	return requests, nil
+}
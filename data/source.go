@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ponbac/majority-wins/game"
+)
+
+// Source fetches the questions for a room's settings from the providers in a registry.
+type Source struct {
+	Registry *Registry
+}
+
+// DefaultProviders returns the providers used when the settings do not name any. Opinion
+// questions only make sense in majority mode, so it defaults to the local pack.
+func DefaultProviders(mode game.GameMode) string {
+	if mode == game.MajorityMode {
+		return "local"
+	}
+	return "opentdb,trivia"
+}
+
+func (s *Source) Validate(settings game.Settings) error {
+	requests, err := s.requests(settings)
+	if err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if _, err := s.Registry.Get(request.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchQuestions fetches questions from the settings' providers, keeping those that match
+// the settings' categories and difficulty.
+func (s *Source) FetchQuestions(ctx context.Context, settings game.Settings) ([]*game.Question, error) {
+	requests, err := s.requests(settings)
+	if err != nil {
+		return nil, err
+	}
+	questions, err := s.Registry.FetchAll(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []*game.Question
+	for _, question := range questions {
+		if matchesSettings(question, settings) {
+			matching = append(matching, question)
+		}
+	}
+	return matching, nil
+}
+
+func (s *Source) requests(settings game.Settings) ([]ProviderRequest, error) {
+	providers := settings.Providers
+	if providers == "" {
+		providers = DefaultProviders(settings.Mode)
+	}
+	return ParseProviderRequests(providers)
+}
+
+// matchesSettings reports whether the question is in one of the categories and of the
+// difficulty of the settings. Questions without a difficulty match any difficulty.
+func matchesSettings(question *game.Question, settings game.Settings) bool {
+	if settings.Difficulty != "" && question.Difficulty != "" && question.Difficulty != settings.Difficulty {
+		return false
+	}
+	if len(settings.Categories) == 0 {
+		return true
+	}
+	category := strings.ToLower(question.Category)
+	for _, c := range settings.Categories {
+		if strings.Contains(category, strings.ToLower(c)) {
+			return true
+		}
+	}
+	return false
+}
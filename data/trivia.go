@@ -1,11 +1,13 @@
 package data
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"html"
-	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/ponbac/majority-wins/game"
@@ -17,14 +19,30 @@ type QuestionType int
 const (
 	None QuestionType = iota
 	MultipleChoice
+	// The questions are asked without their choices, players type the answer
 	FreeText
 )
 
 type Provider struct {
-	Name string
-	Path string
-	Type QuestionType
-	Key  string
+	Name   string
+	Path   string
+	Type   QuestionType
+	Key    string
+	Client *http.Client
+}
+
+var OpenTDBProvider = &Provider{
+	Name: "OpenTDB",
+	Path: "https://opentdb.com/api.php",
+	Type: None,
+	Key:  "",
+}
+
+var OpenTDBTextProvider = &Provider{
+	Name: "OpenTDB free text",
+	Path: "https://opentdb.com/api.php",
+	Type: FreeText,
+	Key:  "",
 }
 
 type ProviderResponse struct {
@@ -41,40 +59,29 @@ type ProviderQuestion struct {
 	IncorrectAnswers []string `json:"incorrect_answers"`
 }
 
-func (p *Provider) FetchQuestions() []*game.Question {
-	// Make request
-	c := http.Client{Timeout: time.Second * 10}
-	resp, err := c.Get(p.Path)
-	if err != nil {
-		log.Error().Err(err).Msg("Could not fetch questions from " + p.Path)
-	}
-	defer resp.Body.Close()
-
-	// Read response in bytes
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Error().Err(err)
+func (p *Provider) FetchQuestions(ctx context.Context, amount int) ([]*game.Question, error) {
+	if amount <= 0 {
+		amount = defaultAmount
 	}
 
-	// Parse response to object
+	// Make request and parse response to object
 	var pResponse ProviderResponse
-	err = json.Unmarshal(bodyBytes, &pResponse)
+	err := fetchJSON(ctx, p.Client, p.Path+"?"+url.Values{"amount": {strconv.Itoa(amount)}}.Encode(), &pResponse)
 	if err != nil {
-		log.Error().Err(err)
+		return nil, err
+	}
+	if pResponse.ResponseCode != 0 {
+		return nil, errors.New(p.Name + " responded with code " + strconv.Itoa(pResponse.ResponseCode))
 	}
-
-	// Extract questions
-	var pQuestions []*ProviderQuestion
-	pQuestions = append(pQuestions, pResponse.Results...)
 
 	// Convert to game.Question
 	var questions []*game.Question
-	for _, pQuestion := range pQuestions {
-		questions = append(questions, pQuestion.ToQuestion())
+	for _, pQuestion := range pResponse.Results {
+		questions = append(questions, withType(pQuestion.ToQuestion(), p.Type))
 	}
 
 	log.Debug().Msgf("Fetched %d questions from %s", len(questions), p.Name)
-	return questions
+	return questions, nil
 }
 
 func (q *ProviderQuestion) ToQuestion() *game.Question {
@@ -109,6 +116,7 @@ func (q *ProviderQuestion) ToQuestion() *game.Question {
 
 	return &game.Question{
 		Category:      q.Category,
+		Difficulty:    q.Difficulty,
 		Type:          q.Type,
 		Reward:        reward,
 		Description:   q.Question,
@@ -118,18 +126,13 @@ func (q *ProviderQuestion) ToQuestion() *game.Question {
 	}
 }
 
-// func main() {
-// 	openTdb := &Provider{
-// 		Name: "OpenTDB",
-// 		Path: "https://opentdb.com/api.php?amount=10&category=9&type=multiple",
-// 		Type: MultipleChoice,
-// 		Key:  "",
-// 	}
-
-// 	c := http.Client{Timeout: time.Second * 10}
-// 	questions := openTdb.FetchQuestions(c)
-
-// 	for _, question := range questions {
-// 		fmt.Println(question)
-// 	}
-// }
+// withType turns the question into a free text question if the provider is of type FreeText.
+// True or false questions are left as they are, they can not be answered with free text.
+func withType(question *game.Question, questionType QuestionType) *game.Question {
+	if questionType != FreeText || question.Type == "boolean" {
+		return question
+	}
+	question.Kind = game.FreeTextQuestion
+	question.Choices = []string{}
+	return question
+}
@@ -0,0 +1,122 @@
+package game
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Time players have to write their bluffs before voting starts
+const BluffDuration = 45 * time.Second
+
+// bluffAuthors returns the players whose bluff is the choice, none if it is the truth.
+func (q *Question) bluffAuthors(choice int) []*Player {
+	authors := []*Player{}
+	if choice < 0 || choice >= len(q.Choices) {
+		return authors
+	}
+	normalized := normalizeAnswer(q.Choices[choice])
+	for player, bluff := range q.Bluffs {
+		if normalizeAnswer(bluff) == normalized {
+			authors = append(authors, player)
+		}
+	}
+	return authors
+}
+
+// addBluffChoices turns the bluffs into the question's choices, equal bluffs as one choice,
+// and hides the truth among them.
+func (q *Question) addBluffChoices() {
+	q.Choices = []string{}
+	for _, bluff := range q.Bluffs {
+		q.addTextAnswer(bluff)
+	}
+	q.Choices = append(q.Choices, q.CorrectChoice)
+	rand.Shuffle(len(q.Choices), func(i, j int) { q.Choices[i], q.Choices[j] = q.Choices[j], q.Choices[i] })
+}
+
+// BluffRule gives the authors of a bluff the question's reward for every player it fooled.
+// A team earns the points of its members' bluffs. It is applied to bluff questions after the
+// other rules.
+type BluffRule struct{}
+
+func (BluffRule) Name() string { return "bluff" }
+
+func (rule BluffRule) Score(s *Scoring) {
+	for _, vote := range s.Question.Answers {
+		for _, author := range s.Question.bluffAuthors(vote) {
+			s.Bonus(author, rule.Name(), s.Question.Reward)
+			if author.team != nil {
+				author.team.Score += s.Question.Reward
+			}
+		}
+	}
+}
+
+// startAnswering collects the bluffs for bluff questions, and shows the question otherwise.
+func (r *Room) startAnswering() {
+	if r.Questions[r.CurrentQuestion].Kind == BluffQuestion {
+		r.showBluff()
+	} else {
+		r.showQuestion()
+	}
+}
+
+// showBluff asks the players to write fake answers to the current question.
+func (r *Room) showBluff() {
+	r.Scene = SceneBluff
+	r.Deadline = time.Now().Add(BluffDuration)
+	r.schedule(BluffDuration)
+	log.Debug().Msg("Room [" + r.ID + "]: Taking bluffs for (" + r.Questions[r.CurrentQuestion].Description + ")")
+	r.broadcastScene()
+}
+
+// closeBluffs mixes the bluffs with the truth and lets the players vote.
+func (r *Room) closeBluffs() {
+	r.Questions[r.CurrentQuestion].addBluffChoices()
+	r.showQuestion()
+}
+
+func (r *Room) handleBluff(player *Player, text string) error {
+	if !r.Players[player] {
+		return ErrUnknownPlayer
+	}
+	if r.Scene != SceneBluff {
+		return ErrWrongScene
+	}
+	if player.Eliminated {
+		return ErrEliminated
+	}
+	question := r.Questions[r.CurrentQuestion]
+	if _, ok := question.Bluffs[player]; ok {
+		return ErrAlreadyBluffed
+	}
+	if normalizeAnswer(text) == "" || len([]rune(text)) > maxAnswerLength {
+		return ErrInvalidAnswer
+	}
+	if question.matchText(text) != noMatch {
+		return ErrBluffIsTruth
+	}
+	if question.Bluffs == nil {
+		question.Bluffs = make(map[*Player]string)
+	}
+	question.Bluffs[player] = strings.TrimSpace(text)
+	r.broadcast(MessagePlayerBluffed, &PlayerBluffedPayload{Name: player.Name})
+	if r.allBluffed() {
+		r.closeBluffs()
+	}
+	return nil
+}
+
+// allBluffed reports whether every connected player still in the game has written a bluff.
+func (r *Room) allBluffed() bool {
+	question := r.Questions[r.CurrentQuestion]
+	for player := range r.Players {
+		if _, ok := question.Bluffs[player]; !ok && player.IsConnected() && !player.Eliminated {
+			return false
+		}
+	}
+	return true
+}
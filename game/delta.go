@@ -0,0 +1,165 @@
+package game
+
+import (
+	"time"
+)
+
+// Incremental room updates. Every delta is broadcast with the next sequence number, a
+// snapshot (MessageState) carries the sequence number of the latest delta it includes.
+const (
+	MessagePlayerJoined    = "player_joined"
+	MessagePlayerLeft      = "player_left"
+	MessagePlayerUpdated   = "player_updated"
+	MessagePlayerAnswered  = "player_answered"
+	MessageSceneChanged    = "scene_changed"
+	MessageScoresUpdated   = "scores_updated"
+	MessageSettingsUpdated = "settings_updated"
+	MessageTeamsUpdated    = "teams_updated"
+	MessagePlayerWagered   = "player_wagered"
+	MessagePlayerBluffed   = "player_bluffed"
+)
+
+type PlayerPayload struct {
+	Player *JSONPlayer `json:"player"`
+}
+
+type PlayerAnsweredPayload struct {
+	Name string `json:"name"`
+	// Only sent to the player's teammates, text for free text questions
+	Choice *int   `json:"choice,omitempty"`
+	Text   string `json:"text,omitempty"`
+}
+
+// PlayerWageredPayload tells that a player has placed their stake, the amount is hidden until
+// the results
+type PlayerWageredPayload struct {
+	Name string `json:"name"`
+}
+
+// PlayerBluffedPayload tells that a player has written their bluff, the bluff is hidden until
+// voting starts
+type PlayerBluffedPayload struct {
+	Name string `json:"name"`
+}
+
+// Reasons a player was removed from the room
+const (
+	ReasonLeft   = "left"
+	ReasonKicked = "kicked"
+	ReasonBanned = "banned"
+)
+
+type PlayerLeftPayload struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type SceneChangedPayload struct {
+	Scene           Scene         `json:"scene"`
+	Round           int           `json:"round"`
+	CurrentQuestion int           `json:"current_question"`
+	Question        *JSONQuestion `json:"question,omitempty"`
+	// Answer, wager or bluff deadline and the server's current time, in unix milliseconds
+	Deadline     int64             `json:"deadline,omitempty"`
+	ServerTime   int64             `json:"server_time"`
+	Presentation *JSONPresentation `json:"presentation,omitempty"`
+}
+
+type SettingsPayload struct {
+	Settings *JSONSettings `json:"settings"`
+}
+
+type ScoresPayload struct {
+	Players []*JSONPlayer `json:"players"`
+	Teams   []*JSONTeam   `json:"teams,omitempty"`
+}
+
+type TeamsPayload struct {
+	Teams []*JSONTeam `json:"teams"`
+}
+
+// broadcast sends the same delta to every connected player and spectator.
+func (r *Room) broadcast(msgType string, payload interface{}) {
+	r.seq++
+	message := encodeMessage(msgType, "", r.seq, payload)
+	for player := range r.Players {
+		r.sendTo(player, message)
+	}
+	for spectator := range r.Spectators {
+		r.sendTo(spectator, message)
+	}
+}
+
+// broadcastEach sends a delta built for each connected player and spectator.
+func (r *Room) broadcastEach(msgType string, payload func(viewer *Player) interface{}) {
+	r.seq++
+	for _, viewers := range []map[*Player]bool{r.Players, r.Spectators} {
+		for viewer := range viewers {
+			if viewer.IsConnected() {
+				r.sendTo(viewer, encodeMessage(msgType, "", r.seq, payload(viewer)))
+			}
+		}
+	}
+}
+
+// sendSnapshot sends the full room state to a player that is new or out of sync.
+func (r *Room) sendSnapshot(player *Player) {
+	r.sendTo(player, encodeMessage(MessageState, "", r.seq, r.ToJSONRoom(player)))
+}
+
+func (r *Room) broadcastPlayer(player *Player) {
+	r.broadcast(MessagePlayerUpdated, &PlayerPayload{Player: player.ToJSONPlayer()})
+}
+
+func (r *Room) broadcastScene() {
+	r.broadcastEach(MessageSceneChanged, func(viewer *Player) interface{} {
+		payload := &SceneChangedPayload{Scene: r.Scene, Round: r.Round, CurrentQuestion: r.CurrentQuestion, ServerTime: time.Now().UnixMilli()}
+		switch r.Scene {
+		case SceneQuestion, SceneResults, SceneBluff:
+			payload.Question = r.Questions[r.CurrentQuestion].ToJSONQuestion(r.Scene == SceneResults, viewer)
+		case SceneWager:
+			payload.Question = r.Questions[r.CurrentQuestion].toJSONWager(viewer)
+		}
+		if r.timedScene() && !r.Deadline.IsZero() {
+			payload.Deadline = r.Deadline.UnixMilli()
+		}
+		payload.Presentation = r.presentation(viewer)
+		return payload
+	})
+}
+
+func (r *Room) broadcastScores() {
+	payload := &ScoresPayload{Players: []*JSONPlayer{}, Teams: r.toJSONTeams()}
+	for player := range r.Players {
+		payload.Players = append(payload.Players, player.ToJSONPlayer())
+	}
+	r.broadcast(MessageScoresUpdated, payload)
+}
+
+// broadcastAnswered tells the room that player has answered, only their teammates see the answer.
+func (r *Room) broadcastAnswered(player *Player, question *Question, choice int) {
+	r.broadcastEach(MessagePlayerAnswered, func(viewer *Player) interface{} {
+		payload := &PlayerAnsweredPayload{Name: player.Name}
+		if player.team == nil || viewer.team != player.team || viewer == player {
+			return payload
+		}
+		if question.Kind == FreeTextQuestion {
+			payload.Text = question.Choices[choice]
+		} else {
+			payload.Choice = &choice
+		}
+		return payload
+	})
+}
+
+func (r *Room) broadcastTeams() {
+	r.broadcast(MessageTeamsUpdated, &TeamsPayload{Teams: r.toJSONTeams()})
+}
+
+// broadcastTeamChange sends every player's team and the teams after players have been moved.
+func (r *Room) broadcastTeamChange() {
+	for player := range r.Players {
+		r.broadcastPlayer(player)
+	}
+	r.broadcastTeams()
+}
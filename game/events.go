@@ -0,0 +1,840 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// An event is something that may change the room state. Events are only handled by the Run goroutine.
+type event interface{}
+
+type joinEvent struct {
+	name     string
+	isLeader bool
+	// Session token of a player to reattach to, empty to join as a new player
+	session string
+	// Join as a spectator, optionally with the presentation view
+	spectator    bool
+	presentation bool
+	result       chan<- joinResult
+}
+
+type joinResult struct {
+	player *Player
+	// Channel the new connection should write from
+	send chan []byte
+	err  error
+}
+
+// disconnectEvent fires when the connection owning send is lost
+type disconnectEvent struct {
+	player *Player
+	send   chan []byte
+}
+
+// abandonedEvent fires when the connection for a newly joined player could not be set up,
+// the seat it reserved was never connected
+type abandonedEvent struct {
+	player *Player
+	send   chan []byte
+}
+
+// reconnectExpiredEvent fires when a disconnected player's grace period is over
+type reconnectExpiredEvent struct {
+	player         *Player
+	disconnectedAt time.Time
+}
+
+// Events caused by client messages carry the message's request id, so the result can be
+// acknowledged or the error sent back.
+
+type voteEvent struct {
+	player *Player
+	id     string
+	vote   int
+}
+
+// answerEvent submits a free text answer, or a guess if number is set
+type answerEvent struct {
+	player *Player
+	id     string
+	text   string
+	number *float64
+}
+
+// bluffEvent submits a fake answer to a bluff question
+type bluffEvent struct {
+	player *Player
+	id     string
+	text   string
+}
+
+// wagerEvent stakes points on the next question
+type wagerEvent struct {
+	player *Player
+	id     string
+	amount int
+}
+
+// acceptAnswerEvent asks to accept a free text answer as correct
+type acceptAnswerEvent struct {
+	player *Player
+	id     string
+	choice int
+}
+
+type startEvent struct {
+	player *Player
+	id     string
+	// When starting a new round from game over, reset the players' scores
+	resetScores bool
+}
+
+// playAgainEvent returns a finished room to the lobby
+type playAgainEvent struct {
+	player      *Player
+	id          string
+	resetScores bool
+}
+
+type transferLeaderEvent struct {
+	player *Player
+	id     string
+	target string
+}
+
+type updateSettingsEvent struct {
+	player *Player
+	id     string
+	update *JSONSettings
+}
+
+// questionsFetchedEvent carries the result of fetching questions for a start requested by player
+type questionsFetchedEvent struct {
+	player    *Player
+	id        string
+	questions []*Question
+	err       error
+}
+
+// removeEvent asks to kick or ban the target player
+type removeEvent struct {
+	player *Player
+	id     string
+	target string
+	reason string
+}
+
+// assignTeamEvent asks to move the target player to another team
+type assignTeamEvent struct {
+	player *Player
+	id     string
+	target string
+	team   int
+}
+
+// balanceTeamsEvent asks to split the players evenly between the teams
+type balanceTeamsEvent struct {
+	player *Player
+	id     string
+}
+
+// syncEvent asks for a full snapshot of the room
+type syncEvent struct {
+	player *Player
+	id     string
+}
+
+// rejectEvent reports an invalid client message back to its sender
+type rejectEvent struct {
+	player *Player
+	id     string
+	err    error
+}
+
+// timerEvent fires when a scheduled scene timer expires
+type timerEvent struct {
+	seq int
+}
+
+// handle applies an event to the room. The transitions are:
+//
+//	lobby    -- start -->            question | wager | bluff
+//	wager    -- all wagered -->      question | bluff
+//	wager    -- timer -->            question | bluff
+//	bluff    -- all bluffed -->      question
+//	bluff    -- timer -->            question
+//	question -- all answered -->     results
+//	question -- timer -->            results
+//	results  -- timer -->            question | wager | bluff | game over
+//	game over -- play again -->      lobby
+//	any      -- last player left --> game over
+//
+// Disconnected players keep their seat for ReconnectGrace before they are removed, seats
+// that were never connected are released right away.
+func (r *Room) handle(e event) {
+	defer r.handleOverflowed()
+	switch e := e.(type) {
+	case joinEvent:
+		r.touch()
+		e.result <- r.handleJoin(e)
+	case disconnectEvent:
+		r.touch()
+		if e.player.spectator {
+			r.removeSpectator(e.player, e.send)
+		} else {
+			r.handleDisconnect(e.player, e.send)
+		}
+	case abandonedEvent:
+		if r.Players[e.player] && e.player.send == e.send {
+			log.Debug().Msg("Room [" + r.ID + "]: " + e.player.Name + " never connected")
+			r.handleLeave(e.player, ReasonLeft)
+		}
+	case reconnectExpiredEvent:
+		if e.player.disconnectedAt.Equal(e.disconnectedAt) && r.Players[e.player] {
+			log.Debug().Msg("Room [" + r.ID + "]: " + e.player.Name + " did not reconnect in time")
+			r.handleLeave(e.player, ReasonLeft)
+		}
+	case voteEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleVote(e.player, e.vote))
+	case answerEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleAnswer(e.player, e.text, e.number))
+	case bluffEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleBluff(e.player, e.text))
+	case wagerEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleWager(e.player, e.amount))
+	case acceptAnswerEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleAcceptAnswer(e.player, e.choice))
+	case startEvent:
+		r.touch()
+		if r.Scene == SceneGameOver {
+			if err := r.handlePlayAgain(e.player, e.resetScores); err != nil {
+				r.reply(e.player, e.id, err)
+				return
+			}
+		}
+		if r.needsQuestions() {
+			r.reply(e.player, e.id, r.fetchQuestions(e.player, e.id))
+		} else {
+			r.reply(e.player, e.id, r.handleStart(e.player))
+		}
+	case transferLeaderEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleTransferLeader(e.player, e.target))
+	case playAgainEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handlePlayAgain(e.player, e.resetScores))
+	case updateSettingsEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleUpdateSettings(e.player, e.update))
+	case questionsFetchedEvent:
+		r.fetching = false
+		if e.err == nil {
+			r.Questions = e.questions
+			r.questionsStale = false
+			e.err = r.handleStart(e.player)
+		}
+		r.reply(e.player, e.id, e.err)
+	case removeEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleRemove(e.player, e.target, e.reason))
+	case assignTeamEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleAssignTeam(e.player, e.target, e.team))
+	case balanceTeamsEvent:
+		r.touch()
+		r.reply(e.player, e.id, r.handleBalanceTeams(e.player))
+	case syncEvent:
+		if r.Players[e.player] || r.Spectators[e.player] {
+			r.sendSnapshot(e.player)
+		}
+		r.reply(e.player, e.id, nil)
+	case rejectEvent:
+		r.reply(e.player, e.id, e.err)
+	case timerEvent:
+		if e.seq == r.timerSeq {
+			r.timer = nil
+			r.handleTimer()
+		}
+	default:
+		log.Warn().Msgf("Room [%s]: Unknown event %T", r.ID, e)
+	}
+}
+
+// handleOverflowed disconnects the connections that could not keep up, the same way as if
+// they had closed.
+func (r *Room) handleOverflowed() {
+	for len(r.overflowed) > 0 {
+		e := r.overflowed[0]
+		r.overflowed = r.overflowed[1:]
+		r.handle(e)
+	}
+}
+
+func (r *Room) handleJoin(e joinEvent) joinResult {
+	if e.spectator {
+		return r.handleWatch(e.presentation)
+	}
+	if e.session != "" {
+		return r.handleResume(e.session)
+	}
+
+	r.joinSeq++
+	player := &Player{Room: r, Score: 0, IsLeader: e.isLeader, Name: e.name, session: newSessionToken(), joinSeq: r.joinSeq}
+	for i := len(r.Players) + 1; player.Name == ""; i++ {
+		if name := "Player " + fmt.Sprint(i); !r.nameTaken(name) {
+			player.Name = name
+		}
+	}
+	if r.banned[strings.ToLower(player.Name)] {
+		return joinResult{err: ErrBanned}
+	}
+	if r.nameTaken(player.Name) {
+		return joinResult{err: ErrNameTaken}
+	}
+	if r.Settings.MaxPlayers > 0 && len(r.Players) >= r.Settings.MaxPlayers {
+		return joinResult{err: ErrRoomFull}
+	}
+	player.send = make(chan []byte, 256)
+	player.team = r.smallestTeam()
+	// Players joining a survival game in progress watch until the next game
+	player.Eliminated = r.survival() && r.Scene != SceneLobby
+	r.AddPlayer(player)
+	if player.team != nil {
+		r.broadcastTeams()
+	}
+	return joinResult{player: player, send: player.send}
+}
+
+// handleWatch adds a spectator. Spectators are not players, they do not count towards
+// max_players, can not vote and are left out of scoring.
+func (r *Room) handleWatch(presentation bool) joinResult {
+	r.spectatorSeq++
+	spectator := &Player{Room: r, Name: "Spectator " + fmt.Sprint(r.spectatorSeq), spectator: true, presentation: presentation}
+	spectator.send = make(chan []byte, 256)
+	r.Spectators[spectator] = true
+	log.Debug().Msg("Room [" + r.ID + "]: Added " + spectator.Name)
+	r.sendSnapshot(spectator)
+	return joinResult{player: spectator, send: spectator.send}
+}
+
+// removeSpectator drops a spectator whose connection owning send was lost. Spectators do
+// not keep a seat, they can simply watch again.
+func (r *Room) removeSpectator(spectator *Player, send chan []byte) {
+	if !r.Spectators[spectator] || spectator.send != send {
+		return
+	}
+	delete(r.Spectators, spectator)
+	close(spectator.send)
+	spectator.send = nil
+	log.Debug().Msg("Room [" + r.ID + "]: Removed " + spectator.Name)
+}
+
+// handleResume reattaches a new connection to the player owning session. A connection
+// that is still open for the player is closed.
+func (r *Room) handleResume(session string) joinResult {
+	for player := range r.Players {
+		if player.session != session {
+			continue
+		}
+		if player.send != nil {
+			close(player.send)
+		}
+		player.send = make(chan []byte, 256)
+		player.disconnectedAt = time.Time{}
+		log.Debug().Msg("Room [" + r.ID + "]: " + player.Name + " reconnected")
+		r.sendSnapshot(player)
+		r.broadcastPlayer(player)
+		// The lead stays with a disconnected player while nobody else is connected
+		if leader := r.leader(); leader == nil || !leader.IsConnected() {
+			r.promoteLeader()
+		}
+		return joinResult{player: player, send: player.send}
+	}
+	return joinResult{err: ErrInvalidSession}
+}
+
+// handleDisconnect keeps the player's seat, score and answers for ReconnectGrace.
+func (r *Room) handleDisconnect(player *Player, send chan []byte) {
+	// Ignore connections that have already been replaced
+	if !r.Players[player] || player.send != send {
+		return
+	}
+	r.disconnect(player)
+	r.broadcastPlayer(player)
+	if player.IsLeader {
+		r.promoteLeader()
+	}
+	r.advanceIfReady()
+}
+
+func (r *Room) disconnect(player *Player) {
+	close(player.send)
+	player.send = nil
+	player.disconnectedAt = time.Now()
+	log.Debug().Msg("Room [" + r.ID + "]: " + player.Name + " disconnected")
+
+	disconnectedAt := player.disconnectedAt
+	time.AfterFunc(r.ReconnectGrace, func() {
+		r.post(reconnectExpiredEvent{player: player, disconnectedAt: disconnectedAt})
+	})
+}
+
+func (r *Room) nameTaken(name string) bool {
+	for p := range r.Players {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Room) handleLeave(player *Player, reason string) {
+	r.RemovePlayer(player, reason)
+	if player.team != nil {
+		r.broadcastTeams()
+	}
+	if player.IsLeader {
+		player.IsLeader = false
+		r.promoteLeader()
+	}
+	if len(r.Players) == 0 && r.Scene != SceneLobby && r.Scene != SceneGameOver {
+		log.Debug().Msg("Room [" + r.ID + "]: No players left, finishing room...")
+		r.endGame()
+		return
+	}
+	r.advanceIfReady()
+}
+
+// advanceIfReady moves on from the current scene if every connected player still in the game
+// has done their part, e.g. after a player left.
+func (r *Room) advanceIfReady() {
+	switch {
+	case r.Scene == SceneQuestion && r.allAnswered():
+		r.showResults()
+	case r.Scene == SceneWager && r.allWagered():
+		r.startAnswering()
+	case r.Scene == SceneBluff && r.allBluffed():
+		r.closeBluffs()
+	}
+}
+
+func (r *Room) handleVote(player *Player, vote int) error {
+	if err := r.checkAnswer(player); err != nil {
+		return err
+	}
+	question := r.Questions[r.CurrentQuestion]
+	if question.Kind != ChoiceQuestion && question.Kind != BluffQuestion {
+		return ErrWrongAnswerKind
+	}
+	if vote < 0 || vote >= len(question.Choices) {
+		return ErrInvalidChoice
+	}
+	if containsPlayer(question.bluffAuthors(vote), player) {
+		return ErrOwnBluff
+	}
+	r.recordAnswer(player, question, vote)
+	return nil
+}
+
+// handleAnswer submits a free text answer, or a guess to a numeric question. Equal answers are
+// grouped into one choice.
+func (r *Room) handleAnswer(player *Player, text string, number *float64) error {
+	if err := r.checkAnswer(player); err != nil {
+		return err
+	}
+	question := r.Questions[r.CurrentQuestion]
+	if question.Kind == NumericQuestion {
+		if number == nil {
+			return ErrWrongAnswerKind
+		}
+		if math.IsNaN(*number) || math.IsInf(*number, 0) {
+			return ErrInvalidAnswer
+		}
+		r.recordAnswer(player, question, question.addNumberAnswer(*number))
+		return nil
+	}
+	if question.Kind != FreeTextQuestion || number != nil {
+		return ErrWrongAnswerKind
+	}
+	if normalizeAnswer(text) == "" || len([]rune(text)) > maxAnswerLength {
+		return ErrInvalidAnswer
+	}
+	r.recordAnswer(player, question, question.addTextAnswer(text))
+	return nil
+}
+
+// checkAnswer returns why the player can not answer the current question, nil if they can.
+func (r *Room) checkAnswer(player *Player) error {
+	if !r.Players[player] {
+		return ErrUnknownPlayer
+	}
+	if r.Scene != SceneQuestion {
+		return ErrWrongScene
+	}
+	if player.Eliminated {
+		return ErrEliminated
+	}
+	question := r.Questions[r.CurrentQuestion]
+	if _, ok := question.Answers[player]; ok {
+		return ErrAlreadyVoted
+	}
+	if player.team != nil && r.Settings.TeamAnswer == TeamAnswerFirst && r.hasAnswered(player, question) {
+		return ErrTeamAnswered
+	}
+	return nil
+}
+
+func (r *Room) recordAnswer(player *Player, question *Question, vote int) {
+	question.Answers[player] = vote
+	question.answerOrder = append(question.answerOrder, player)
+	if question.AnsweredAt == nil {
+		question.AnsweredAt = make(map[*Player]time.Time)
+	}
+	question.AnsweredAt[player] = time.Now()
+	r.broadcastAnswered(player, question, vote)
+	if r.allAnswered() {
+		r.showResults()
+	}
+}
+
+// handleAcceptAnswer lets the leader accept a free text answer the matching did not, e.g. a
+// borderline one. The question is scored again with the answer counted as correct.
+func (r *Room) handleAcceptAnswer(player *Player, choice int) error {
+	if !player.IsLeader || !r.Players[player] {
+		return ErrNotLeader
+	}
+	if r.Scene != SceneResults {
+		return ErrWrongScene
+	}
+	question := r.Questions[r.CurrentQuestion]
+	if question.Kind != FreeTextQuestion || r.Settings.Mode != ClassicMode {
+		return ErrNotAcceptable
+	}
+	if choice < 0 || choice >= len(question.Choices) {
+		return ErrInvalidChoice
+	}
+	if containsInt(question.correctChoices(), choice) {
+		return nil
+	}
+
+	question.Accepted = append(question.Accepted, choice)
+	log.Debug().Msg("Room [" + r.ID + "]: " + player.Name + " accepted the answer " + question.Choices[choice])
+	r.rescore()
+	r.broadcastScores()
+	r.broadcastScene()
+	return nil
+}
+
+func (r *Room) handleStart(player *Player) error {
+	// Leader can start the game if the game is not yet started
+	if !player.IsLeader {
+		return ErrNotLeader
+	}
+	if r.Scene != SceneLobby {
+		return ErrWrongScene
+	}
+	if r.fetching {
+		return ErrBusy
+	}
+	return r.startGame()
+}
+
+// handlePlayAgain returns a finished room to the lobby so the leader can start another round.
+func (r *Room) handlePlayAgain(player *Player, resetScores bool) error {
+	if !player.IsLeader {
+		return ErrNotLeader
+	}
+	if r.Scene != SceneGameOver {
+		return ErrWrongScene
+	}
+	r.ResetGame(resetScores)
+	log.Debug().Msg("Room [" + r.ID + "]: Back to lobby for another round")
+	if resetScores {
+		r.broadcastScores()
+	}
+	r.broadcastScene()
+	return nil
+}
+
+// handleUpdateSettings lets the leader change the room settings while in the lobby.
+func (r *Room) handleUpdateSettings(player *Player, update *JSONSettings) error {
+	if !player.IsLeader {
+		return ErrNotLeader
+	}
+	if r.Scene != SceneLobby {
+		return ErrWrongScene
+	}
+	if r.fetching {
+		return ErrBusy
+	}
+	settings, err := r.Settings.Apply(update)
+	if err != nil {
+		return err
+	}
+	if settings.MaxPlayers > 0 && settings.MaxPlayers < len(r.Players) {
+		return invalidSettings("max_players is less than the number of players in the room")
+	}
+	if r.Source != nil {
+		if err := r.Source.Validate(settings); err != nil {
+			return invalidSettings(err.Error())
+		}
+	}
+
+	if r.Settings.questionsChanged(settings) || settings.NQuestions > len(r.Questions) {
+		r.questionsStale = true
+	}
+	teamsChanged := r.Settings.Teams != settings.Teams
+	r.Settings = settings
+	log.Debug().Msg("Room [" + r.ID + "]: Settings updated by " + player.Name)
+	r.broadcast(MessageSettingsUpdated, &SettingsPayload{Settings: settings.ToJSONSettings()})
+	if teamsChanged {
+		r.SetupTeams(settings.Teams)
+		r.broadcastTeamChange()
+	}
+	return nil
+}
+
+// handleAssignTeam lets the leader move a player to another team while in the lobby.
+func (r *Room) handleAssignTeam(player *Player, target string, teamID int) error {
+	if !player.IsLeader || !r.Players[player] {
+		return ErrNotLeader
+	}
+	if r.Scene != SceneLobby {
+		return ErrWrongScene
+	}
+	team := r.teamByID(teamID)
+	if team == nil {
+		return ErrUnknownTeam
+	}
+	for p := range r.Players {
+		if p.Name == target {
+			p.team = team
+			log.Debug().Msg("Room [" + r.ID + "]: " + p.Name + " moved to " + team.Name)
+			r.broadcastPlayer(p)
+			r.broadcastTeams()
+			return nil
+		}
+	}
+	return ErrUnknownPlayer
+}
+
+// handleBalanceTeams lets the leader reshuffle the players into even teams while in the lobby.
+func (r *Room) handleBalanceTeams(player *Player) error {
+	if !player.IsLeader || !r.Players[player] {
+		return ErrNotLeader
+	}
+	if r.Scene != SceneLobby {
+		return ErrWrongScene
+	}
+	if len(r.Teams) == 0 {
+		return ErrUnknownTeam
+	}
+	r.balanceTeams()
+	log.Debug().Msg("Room [" + r.ID + "]: Teams balanced by " + player.Name)
+	r.broadcastTeamChange()
+	return nil
+}
+
+// needsQuestions reports whether questions must be fetched before the game can start.
+func (r *Room) needsQuestions() bool {
+	return r.Source != nil && r.Scene == SceneLobby && r.questionsStale
+}
+
+// fetchQuestions fetches questions for the current settings without blocking the room. The
+// game is started, or the error reported to player, once they have been fetched.
+func (r *Room) fetchQuestions(player *Player, id string) error {
+	if !player.IsLeader {
+		return ErrNotLeader
+	}
+	if r.fetching {
+		return ErrBusy
+	}
+	r.fetching = true
+	source := r.Source
+	settings := r.Settings.copy()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), FetchTimeout)
+		defer cancel()
+		questions, err := source.FetchQuestions(ctx, settings)
+		if err == nil && len(questions) == 0 {
+			err = ErrNoQuestions
+		}
+		r.post(questionsFetchedEvent{player: player, id: id, questions: questions, err: err})
+	}()
+	log.Debug().Msg("Room [" + r.ID + "]: Fetching questions...")
+	return errDeferred
+}
+
+// handleTransferLeader lets the leader hand control of the room to another player.
+func (r *Room) handleTransferLeader(player *Player, target string) error {
+	if !player.IsLeader || !r.Players[player] {
+		return ErrNotLeader
+	}
+	for p := range r.Players {
+		if p.Name == target && p != player {
+			r.setLeader(p)
+			return nil
+		}
+	}
+	return ErrUnknownPlayer
+}
+
+// handleRemove lets the leader kick a player, or ban them from joining again under the same name.
+// Their session is removed with them, so they can not reconnect.
+func (r *Room) handleRemove(player *Player, target string, reason string) error {
+	if !player.IsLeader || !r.Players[player] {
+		return ErrNotLeader
+	}
+	for p := range r.Players {
+		if p.Name != target || p == player {
+			continue
+		}
+		if reason == ReasonBanned {
+			r.banned[strings.ToLower(p.Name)] = true
+		}
+		r.sendTo(p, encodeMessage(MessageRemoved, "", 0, &RemovedPayload{Reason: reason}))
+		r.handleLeave(p, reason)
+		return nil
+	}
+	return ErrUnknownPlayer
+}
+
+// leader returns the room's leader, nil if there is none.
+func (r *Room) leader() *Player {
+	for p := range r.Players {
+		if p.IsLeader {
+			return p
+		}
+	}
+	return nil
+}
+
+// promoteLeader makes the player that has been in the room the longest leader,
+// preferring connected players.
+func (r *Room) promoteLeader() {
+	var next *Player
+	for p := range r.Players {
+		if next == nil || (p.IsConnected() && !next.IsConnected()) ||
+			(p.IsConnected() == next.IsConnected() && p.joinSeq < next.joinSeq) {
+			next = p
+		}
+	}
+	if next != nil {
+		r.setLeader(next)
+	}
+}
+
+func (r *Room) setLeader(leader *Player) {
+	for p := range r.Players {
+		if p.IsLeader != (p == leader) {
+			p.IsLeader = p == leader
+			r.broadcastPlayer(p)
+		}
+	}
+	log.Debug().Msg("Room [" + r.ID + "]: " + leader.Name + " is now leader")
+}
+
+func (r *Room) handleTimer() {
+	switch r.Scene {
+	case SceneQuestion:
+		log.Debug().Msg("Room [" + r.ID + "]: Answer time is up")
+		r.showResults()
+	case SceneResults:
+		r.nextScene()
+	case SceneWager:
+		log.Debug().Msg("Room [" + r.ID + "]: Wager time is up")
+		r.startAnswering()
+	case SceneBluff:
+		log.Debug().Msg("Room [" + r.ID + "]: Bluff time is up")
+		r.closeBluffs()
+	}
+}
+
+// allAnswered reports whether every connected player, or their team, has answered the
+// current question.
+func (r *Room) allAnswered() bool {
+	question := r.Questions[r.CurrentQuestion]
+	for player := range r.Players {
+		if !player.IsConnected() || player.Eliminated {
+			continue
+		}
+		if !r.hasAnswered(player, question) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Room) startGame() error {
+	playable := r.playableQuestions()
+	if len(playable) == 0 {
+		log.Warn().Msg("Room [" + r.ID + "]: No playable questions, can not start")
+		return ErrNoQuestions
+	}
+	r.Questions = playable
+	r.shuffleQuestions()
+	// Survival goes on until the players are knocked out, or the questions run out
+	if !r.survival() {
+		r.selectNQuestions(r.Settings.NQuestions)
+	}
+	r.startLives()
+	r.CurrentQuestion = 0
+	r.Round++
+	r.Questions[len(r.Questions)-1].finalWager = r.Settings.FinalWager
+	r.prepareQuestion(r.Questions[0])
+	r.askQuestion()
+	return nil
+}
+
+func (r *Room) showQuestion() {
+	r.Scene = SceneQuestion
+	r.Deadline = time.Time{}
+	r.Questions[r.CurrentQuestion].AskedAt = time.Now()
+	if d := r.answerTime(r.Questions[r.CurrentQuestion]); d > 0 {
+		r.Deadline = time.Now().Add(d)
+		r.schedule(d)
+	} else {
+		r.cancelTimer()
+	}
+	log.Debug().Msg("Room [" + r.ID + "]: Starting question (" + r.Questions[r.CurrentQuestion].Description + ")")
+	r.broadcastScene()
+}
+
+func (r *Room) showResults() {
+	r.Scene = SceneResults
+	log.Debug().Msg("Room [" + r.ID + "]: Displaying results for (" + r.Questions[r.CurrentQuestion].Description + ")")
+	r.awardScores(r.Questions[r.CurrentQuestion])
+	r.schedule(r.Settings.ResultsDuration)
+	r.broadcastScores()
+	r.broadcastScene()
+}
+
+// nextScene moves on from the results of the current question.
+func (r *Room) nextScene() {
+	if r.survivalOver() || r.NextQuestion() == nil {
+		r.endGame()
+		return
+	}
+	r.askQuestion()
+}
+
+func (r *Room) endGame() {
+	r.cancelTimer()
+	r.Scene = SceneGameOver
+	log.Debug().Msg("Room [" + r.ID + "]: Game over")
+	r.finishRound()
+	r.markFinished()
+	r.broadcastScores()
+	r.broadcastScene()
+}
@@ -0,0 +1,443 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// A step builds the next event to handle from the room's current state, so events such as
+// timers and disconnects can refer to the latest timer or connection.
+type step func(r *Room, players []*Player) event
+
+func start(i int) step {
+	return func(r *Room, players []*Player) event { return startEvent{player: players[i], id: "start"} }
+}
+
+func vote(i int, choice int) step {
+	return func(r *Room, players []*Player) event { return voteEvent{player: players[i], id: "vote", vote: choice} }
+}
+
+func wager(i int, amount int) step {
+	return func(r *Room, players []*Player) event {
+		return wagerEvent{player: players[i], id: "wager", amount: amount}
+	}
+}
+
+// finalWager makes the last question a wager question and gives every player score points
+// to stake, it must come before the game is started.
+func finalWager(score int) step {
+	return func(r *Room, players []*Player) event {
+		r.Settings.FinalWager = true
+		for _, player := range players {
+			player.Score = score
+		}
+		return nil
+	}
+}
+
+func playAgain(i int, resetScores bool) step {
+	return func(r *Room, players []*Player) event {
+		return playAgainEvent{player: players[i], id: "play_again", resetScores: resetScores}
+	}
+}
+
+func timeUp() step {
+	return func(r *Room, players []*Player) event { return timerEvent{seq: r.timerSeq} }
+}
+
+// staleTimer is a timer that was replaced before it fired.
+func staleTimer() step {
+	return func(r *Room, players []*Player) event { return timerEvent{seq: r.timerSeq - 1} }
+}
+
+func disconnect(i int) step {
+	return func(r *Room, players []*Player) event {
+		return disconnectEvent{player: players[i], send: players[i].send}
+	}
+}
+
+func resume(i int) step {
+	return func(r *Room, players []*Player) event {
+		return joinEvent{session: players[i].session, result: make(chan joinResult, 1)}
+	}
+}
+
+// abandon fails the connection of the player, as if the websocket upgrade failed.
+func abandon(i int) step {
+	return func(r *Room, players []*Player) event {
+		return abandonedEvent{player: players[i], send: players[i].send}
+	}
+}
+
+func reconnectExpired(i int) step {
+	return func(r *Room, players []*Player) event {
+		return reconnectExpiredEvent{player: players[i], disconnectedAt: players[i].disconnectedAt}
+	}
+}
+
+// overflow fills the player's send buffer, so the next message to them overflows it.
+func overflow(i int) step {
+	return func(r *Room, players []*Player) event {
+		for len(players[i].send) < cap(players[i].send) {
+			players[i].send <- nil
+		}
+		return nil
+	}
+}
+
+// newTestRoom returns a room with n questions whose first choice is correct, and the named
+// players joined, the first as leader. Run is not started, events are handled directly.
+func newTestRoom(t *testing.T, n int, names ...string) (*Room, []*Player) {
+	r := NewRoom("TEST")
+	r.Settings.NQuestions = n
+	for i := 0; i < n; i++ {
+		r.Questions = append(r.Questions, &Question{Type: "Quiz", Description: "Question", Choices: []string{"Right", "Wrong"}, CorrectChoice: "Right", Reward: 1, Answers: make(map[*Player]int)})
+	}
+	players := []*Player{}
+	for i, name := range names {
+		result := make(chan joinResult, 1)
+		r.handle(joinEvent{name: name, isLeader: i == 0, result: result})
+		joined := <-result
+		if joined.err != nil {
+			t.Fatalf("%s could not join: %v", name, joined.err)
+		}
+		players = append(players, joined.player)
+	}
+	return r, players
+}
+
+func runSteps(r *Room, players []*Player, steps []step) {
+	for _, s := range steps {
+		if e := s(r, players); e != nil {
+			r.handle(e)
+		}
+	}
+}
+
+// lastError returns the code of the last error sent to the player, empty if there was none.
+func lastError(player *Player) string {
+	code := ""
+	for player.send != nil && len(player.send) > 0 {
+		var message Message
+		if json.Unmarshal(<-player.send, &message) != nil || message.Type != MessageError {
+			continue
+		}
+		var payload ErrorPayload
+		json.Unmarshal(message.Payload, &payload)
+		code = payload.Code
+	}
+	return code
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name      string
+		questions int
+		steps     []step
+		scene     Scene
+		// Expected score of each player, and the error last sent to each
+		scores []int
+		errors []string
+		check  func(t *testing.T, r *Room, players []*Player)
+	}{
+		{
+			name:   "leader starts the game",
+			steps:  []step{start(0)},
+			scene:  SceneQuestion,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+		},
+		{
+			name:   "only the leader can start",
+			steps:  []step{start(1)},
+			scene:  SceneLobby,
+			scores: []int{0, 0},
+			errors: []string{"", "not_leader"},
+		},
+		{
+			name:   "voting outside a question is rejected",
+			steps:  []step{vote(1, 0)},
+			scene:  SceneLobby,
+			scores: []int{0, 0},
+			errors: []string{"", "wrong_scene"},
+		},
+		{
+			name:   "all answered shows the results",
+			steps:  []step{start(0), vote(0, 0), vote(1, 1)},
+			scene:  SceneResults,
+			scores: []int{2, 0},
+			errors: []string{"", ""},
+		},
+		{
+			name:   "voting twice is rejected",
+			steps:  []step{start(0), vote(0, 0), vote(0, 1)},
+			scene:  SceneQuestion,
+			scores: []int{0, 0},
+			errors: []string{"already_voted", ""},
+		},
+		{
+			name:   "invalid choice is rejected",
+			steps:  []step{start(0), vote(0, 2)},
+			scene:  SceneQuestion,
+			scores: []int{0, 0},
+			errors: []string{"invalid_choice", ""},
+		},
+		{
+			name:   "timer ends the question",
+			steps:  []step{start(0), vote(0, 0), timeUp()},
+			scene:  SceneResults,
+			scores: []int{2, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				question := r.Questions[0]
+				if len(question.IncorrectPlayers) != 1 || question.IncorrectPlayers[0] != players[1] {
+					t.Errorf("players that did not answer should be incorrect, got %v", question.IncorrectPlayers)
+				}
+			},
+		},
+		{
+			name:   "stale timer is ignored",
+			steps:  []step{start(0), vote(0, 0), vote(1, 0), staleTimer()},
+			scene:  SceneResults,
+			scores: []int{2, 2},
+			errors: []string{"", ""},
+		},
+		{
+			name:      "results move on to the next question",
+			questions: 2,
+			steps:     []step{start(0), vote(0, 0), vote(1, 0), timeUp()},
+			scene:     SceneQuestion,
+			scores:    []int{2, 2},
+			errors:    []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if r.CurrentQuestion != 1 {
+					t.Errorf("current question = %d, want 1", r.CurrentQuestion)
+				}
+			},
+		},
+		{
+			name:      "last results end the game",
+			questions: 2,
+			steps:     []step{start(0), vote(0, 0), vote(1, 1), timeUp(), vote(0, 0), vote(1, 0), timeUp()},
+			scene:     SceneGameOver,
+			scores:    []int{4, 2},
+			errors:    []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if players[0].Wins != 1 || players[1].Wins != 0 {
+					t.Errorf("wins = %d, %d, want 1, 0", players[0].Wins, players[1].Wins)
+				}
+				if players[0].TotalScore != 4 {
+					t.Errorf("total score = %d, want 4", players[0].TotalScore)
+				}
+			},
+		},
+		{
+			name:   "correct answers win the stake",
+			steps:  []step{finalWager(10), start(0), wager(0, 5), wager(1, 10), vote(0, 0), vote(1, 0)},
+			scene:  SceneResults,
+			scores: []int{17, 22},
+			errors: []string{"", ""},
+		},
+		{
+			name:   "wrong answers lose the stake",
+			steps:  []step{finalWager(10), start(0), wager(0, 5), wager(1, 5), vote(0, 0), vote(1, 1)},
+			scene:  SceneResults,
+			scores: []int{17, 5},
+			errors: []string{"", ""},
+		},
+		{
+			name:   "not answering loses the stake",
+			steps:  []step{finalWager(10), start(0), wager(0, 5), wager(1, 5), vote(0, 0), timeUp()},
+			scene:  SceneResults,
+			scores: []int{17, 5},
+			errors: []string{"", ""},
+		},
+		{
+			name:   "play again keeps the scores",
+			steps:  []step{start(0), vote(0, 0), vote(1, 1), timeUp(), playAgain(0, false)},
+			scene:  SceneLobby,
+			scores: []int{2, 0},
+			errors: []string{"", ""},
+		},
+		{
+			name:   "play again can reset the scores",
+			steps:  []step{start(0), vote(0, 0), vote(1, 1), timeUp(), playAgain(0, true), start(0)},
+			scene:  SceneQuestion,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if r.Round != 2 || len(r.Questions[0].Answers) != 0 {
+					t.Errorf("round = %d with %d answers, want a fresh round 2", r.Round, len(r.Questions[0].Answers))
+				}
+			},
+		},
+		{
+			name:   "play again is only possible after the game",
+			steps:  []step{start(0), playAgain(0, false)},
+			scene:  SceneQuestion,
+			scores: []int{0, 0},
+			errors: []string{"wrong_scene", ""},
+		},
+		{
+			name:   "disconnecting the last voter shows the results",
+			steps:  []step{start(0), vote(0, 0), disconnect(1)},
+			scene:  SceneResults,
+			scores: []int{2, 0},
+			errors: []string{"", ""},
+		},
+		{
+			name:   "disconnecting leader hands over the lead",
+			steps:  []step{disconnect(0)},
+			scene:  SceneLobby,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if players[0].IsConnected() || players[0].IsLeader || !players[1].IsLeader {
+					t.Error("the connected player should lead once the leader disconnects")
+				}
+				if !r.Players[players[0]] {
+					t.Error("disconnected players should keep their seat")
+				}
+			},
+		},
+		{
+			name:   "resume keeps the seat and score",
+			steps:  []step{start(0), vote(0, 0), disconnect(0), vote(1, 1), resume(0)},
+			scene:  SceneResults,
+			scores: []int{2, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if !players[0].IsConnected() || len(r.Players) != 2 {
+					t.Error("the player should be back in their seat")
+				}
+			},
+		},
+		{
+			name:   "resuming while the leader is away takes over the lead",
+			steps:  []step{disconnect(1), disconnect(0), resume(1), start(1)},
+			scene:  SceneQuestion,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if players[0].IsLeader || !players[1].IsLeader {
+					t.Error("the resumed player should lead while the leader is disconnected")
+				}
+			},
+		},
+		{
+			name: "disconnect of a replaced connection is ignored",
+			steps: []step{disconnect(1), resume(1), func(r *Room, players []*Player) event {
+				// The connection closed by resuming reports its disconnect late
+				return disconnectEvent{player: players[1], send: make(chan []byte)}
+			}},
+			scene:  SceneLobby,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if !players[1].IsConnected() {
+					t.Error("the resumed connection should stay connected")
+				}
+			},
+		},
+		{
+			name:   "expired reconnect removes the player",
+			steps:  []step{disconnect(0), reconnectExpired(0)},
+			scene:  SceneLobby,
+			scores: []int{0},
+			errors: []string{""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if r.Players[players[0]] || !players[1].IsLeader {
+					t.Error("the player should be removed and the lead handed over")
+				}
+			},
+		},
+		{
+			name:   "seat that never connected is released",
+			steps:  []step{abandon(1)},
+			scene:  SceneLobby,
+			scores: []int{0},
+			errors: []string{""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if r.Players[players[1]] || r.nameTaken(players[1].Name) {
+					t.Error("the seat and name should be free at once")
+				}
+			},
+		},
+		{
+			name: "expiry after resuming is ignored",
+			steps: []step{disconnect(1), func(r *Room, players []*Player) event {
+				expired := reconnectExpiredEvent{player: players[1], disconnectedAt: players[1].disconnectedAt}
+				r.handle(resume(1)(r, players))
+				return expired
+			}},
+			scene:  SceneLobby,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if !r.Players[players[1]] || !players[1].IsConnected() {
+					t.Error("the resumed player should stay in the room")
+				}
+			},
+		},
+		{
+			name:   "unknown session is rejected",
+			steps:  []step{},
+			scene:  SceneLobby,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				result := make(chan joinResult, 1)
+				r.handle(joinEvent{session: "nope", result: result})
+				if joined := <-result; joined.err != ErrInvalidSession {
+					t.Errorf("join error = %v, want %v", joined.err, ErrInvalidSession)
+				}
+			},
+		},
+		{
+			name:   "overflowing leader is disconnected",
+			steps:  []step{overflow(0), start(0)},
+			scene:  SceneQuestion,
+			scores: []int{0, 0},
+			errors: []string{"", ""},
+			check: func(t *testing.T, r *Room, players []*Player) {
+				if players[0].IsConnected() || players[0].IsLeader || !players[1].IsLeader {
+					t.Error("the overflowing leader should be disconnected and the lead handed over")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			questions := tt.questions
+			if questions == 0 {
+				questions = 1
+			}
+			r, players := newTestRoom(t, questions, "alice", "bob")
+			runSteps(r, players, tt.steps)
+
+			if r.Scene != tt.scene {
+				t.Errorf("scene = %d, want %d", r.Scene, tt.scene)
+			}
+			remaining := []*Player{}
+			for _, player := range players {
+				if r.Players[player] {
+					remaining = append(remaining, player)
+				}
+			}
+			for i, player := range remaining {
+				if i < len(tt.scores) && player.Score != tt.scores[i] {
+					t.Errorf("%s score = %d, want %d", player.Name, player.Score, tt.scores[i])
+				}
+				if i < len(tt.errors) {
+					if code := lastError(player); code != tt.errors[i] {
+						t.Errorf("%s last error = %q, want %q", player.Name, code, tt.errors[i])
+					}
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, r, players)
+			}
+		})
+	}
+}
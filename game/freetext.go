@@ -0,0 +1,188 @@
+package game
+
+import (
+	"strings"
+	"unicode"
+)
+
+// QuestionKind is how a question is answered
+type QuestionKind int
+
+const (
+	// Players vote for one of the question's choices
+	ChoiceQuestion QuestionKind = iota
+	// Players type their answer. Equal answers are grouped into the question's choices as they
+	// come in, so a free text answer is a vote like any other once submitted.
+	FreeTextQuestion
+	// Players guess a number and score by how close they get to the CorrectChoice. Guesses are
+	// grouped into the question's choices like free text answers.
+	NumericQuestion
+	// Players first write fake answers, which are mixed with the CorrectChoice into the
+	// question's choices, then vote for the one they think is true.
+	BluffQuestion
+)
+
+func (k QuestionKind) String() string {
+	switch k {
+	case FreeTextQuestion:
+		return "free_text"
+	case NumericQuestion:
+		return "numeric"
+	case BluffQuestion:
+		return "bluff"
+	}
+	return "choice"
+}
+
+// Longest free text answer accepted, in characters
+const maxAnswerLength = 100
+
+// Letters folded to their unaccented form when comparing answers
+var accentFolds = map[rune]string{
+	'á': "a", 'à': "a", 'â': "a", 'ä': "a", 'ã': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'é': "e", 'è': "e", 'ê': "e", 'ë': "e",
+	'í': "i", 'ì': "i", 'î': "i", 'ï': "i", 'ñ': "n",
+	'ó': "o", 'ò': "o", 'ô': "o", 'ö': "o", 'õ': "o", 'ø': "o", 'œ': "oe",
+	'ß': "ss", 'ú': "u", 'ù': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y",
+}
+
+// normalizeAnswer lower cases the answer, folds accents and drops punctuation and extra
+// whitespace, so answers that only differ in those are equal.
+func normalizeAnswer(answer string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(answer) {
+		switch {
+		case accentFolds[r] != "":
+			b.WriteString(accentFolds[r])
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-':
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Match of a free text answer against the correct answer
+type answerMatch int
+
+const (
+	noMatch answerMatch = iota
+	// Close, but not close enough to be accepted without the leader
+	borderlineMatch
+	match
+)
+
+// typoTolerance returns the number of typos allowed in an answer of length n.
+func typoTolerance(n int) int {
+	tolerance := n / 5
+	if tolerance > 3 {
+		tolerance = 3
+	}
+	return tolerance
+}
+
+// matchAnswer compares a normalized answer with a normalized correct answer.
+func matchAnswer(answer string, correct string) answerMatch {
+	if answer == "" || correct == "" {
+		return noMatch
+	}
+	tolerance := typoTolerance(len([]rune(correct)))
+	distance := levenshtein(answer, correct)
+	if distance <= tolerance {
+		return match
+	}
+	if distance == tolerance+1 || (len([]rune(answer)) >= 3 && (strings.Contains(correct, answer) || strings.Contains(answer, correct))) {
+		return borderlineMatch
+	}
+	return noMatch
+}
+
+// levenshtein returns the number of single character edits turning a into b.
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// addTextAnswer returns the choice the free text answer belongs to, adding it as a new
+// choice unless an equal answer has been given before.
+func (q *Question) addTextAnswer(text string) int {
+	normalized := normalizeAnswer(text)
+	for i, choice := range q.Choices {
+		if normalizeAnswer(choice) == normalized {
+			return i
+		}
+	}
+	q.Choices = append(q.Choices, strings.TrimSpace(text))
+	return len(q.Choices) - 1
+}
+
+// matchChoice returns the best match of the choice against the correct answer and its aliases.
+func (q *Question) matchChoice(i int) answerMatch {
+	return q.matchText(q.Choices[i])
+}
+
+// matchText returns the best match of the text against the correct answer and its aliases.
+func (q *Question) matchText(text string) answerMatch {
+	best := noMatch
+	answer := normalizeAnswer(text)
+	for _, correct := range append([]string{q.CorrectChoice}, q.Aliases...) {
+		if m := matchAnswer(answer, normalizeAnswer(correct)); m > best {
+			best = m
+		}
+	}
+	return best
+}
+
+// correctChoices returns the choices that are correct answers to the question. Free text
+// answers are correct if they match the answer or an alias, or the leader accepted them.
+func (q *Question) correctChoices() []int {
+	if q.Kind != FreeTextQuestion {
+		return []int{indexOfAnswer(q)}
+	}
+	correct := append([]int{}, q.Accepted...)
+	for i := range q.Choices {
+		if !containsInt(correct, i) && q.matchChoice(i) == match {
+			correct = append(correct, i)
+		}
+	}
+	return correct
+}
+
+// borderlineChoices returns the free text answers close to the answer that the leader may
+// want to accept.
+func (q *Question) borderlineChoices() []int {
+	borderline := []int{}
+	if q.Kind != FreeTextQuestion {
+		return borderline
+	}
+	for i := range q.Choices {
+		if !containsInt(q.Accepted, i) && q.matchChoice(i) == borderlineMatch {
+			borderline = append(borderline, i)
+		}
+	}
+	return borderline
+}
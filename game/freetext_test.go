@@ -0,0 +1,201 @@
+package game
+
+import "testing"
+
+func answer(i int, text string) step {
+	return func(r *Room, players []*Player) event {
+		return answerEvent{player: players[i], id: "answer", text: text}
+	}
+}
+
+// acceptAnswer accepts the current question's choice with the given text.
+func acceptAnswer(i int, text string) step {
+	return func(r *Room, players []*Player) event {
+		choice := -1
+		for j, c := range r.Questions[r.CurrentQuestion].Choices {
+			if c == text {
+				choice = j
+			}
+		}
+		return acceptAnswerEvent{player: players[i], id: "accept_answer", choice: choice}
+	}
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   string
+	}{
+		{"Stockholm", "stockholm"},
+		{"Göteborg", "goteborg"},
+		{"Malmö!", "malmo"},
+		{"  New-York  ", "new york"},
+		{"Æbleskiver", "aebleskiver"},
+		{"Straße", "strasse"},
+		{"Hello,   World", "hello world"},
+		{"R2-D2", "r2 d2"},
+		{"?!.", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeAnswer(tt.answer); got != tt.want {
+			t.Errorf("normalizeAnswer(%q) = %q, want %q", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestTypoTolerance(t *testing.T) {
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{0, 0},
+		{4, 0},
+		{5, 1},
+		{10, 2},
+		{15, 3},
+		{30, 3},
+	}
+	for _, tt := range tests {
+		if got := typoTolerance(tt.n); got != tt.want {
+			t.Errorf("typoTolerance(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"", "", 0},
+		{"", "oslo", 4},
+		{"oslo", "oslo", 0},
+		{"oslo", "osla", 1},
+		{"olso", "oslo", 2},
+		{"stockholm", "stokholm", 1},
+		{"kitten", "sitting", 3},
+		{"malmo", "malmö", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMatchAnswer(t *testing.T) {
+	tests := []struct {
+		answer  string
+		correct string
+		want    answerMatch
+	}{
+		{"stockholm", "stockholm", match},
+		// One typo is allowed in a word of nine letters
+		{"stokholm", "stockholm", match},
+		{"stokolm", "stockholm", borderlineMatch},
+		{"stkolm", "stockholm", noMatch},
+		// Parts of the answer are close enough to ask the leader
+		{"stock", "stockholm", borderlineMatch},
+		{"stockholm city", "stockholm", borderlineMatch},
+		{"st", "stockholm", noMatch},
+		// No typos are allowed in short words
+		{"osla", "oslo", borderlineMatch},
+		{"olso", "oslo", noMatch},
+		{"", "oslo", noMatch},
+		{"oslo", "", noMatch},
+	}
+	for _, tt := range tests {
+		if got := matchAnswer(tt.answer, tt.correct); got != tt.want {
+			t.Errorf("matchAnswer(%q, %q) = %d, want %d", tt.answer, tt.correct, got, tt.want)
+		}
+	}
+}
+
+func TestMatchText(t *testing.T) {
+	question := &Question{Kind: FreeTextQuestion, CorrectChoice: "Göteborg", Aliases: []string{"Gothenburg"}}
+	tests := []struct {
+		text string
+		want answerMatch
+	}{
+		{"goteborg", match},
+		{"GÖTEBORG!", match},
+		{"Gothenborg", match},
+		{"Malmö", noMatch},
+	}
+	for _, tt := range tests {
+		if got := question.matchText(tt.text); got != tt.want {
+			t.Errorf("matchText(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptAnswer(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []step
+		scores []int
+		// Expected streak of each player, and the error last sent to the leader
+		streaks []int
+		err     string
+	}{
+		{
+			name:    "borderline answer is wrong until accepted",
+			steps:   []step{start(0), answer(0, "Stockholm"), answer(1, "Stockholm"), timeUp(), answer(0, "Stockholm"), answer(1, "Stokolm")},
+			scores:  []int{5, 1},
+			streaks: []int{2, 0},
+		},
+		{
+			name:    "accepting reverts the negative bonus and continues the streak",
+			steps:   []step{start(0), answer(0, "Stockholm"), answer(1, "Stockholm"), timeUp(), answer(0, "Stockholm"), answer(1, "Stokolm"), acceptAnswer(0, "Stokolm")},
+			scores:  []int{5, 5},
+			streaks: []int{2, 2},
+		},
+		{
+			name:    "accepting twice scores once",
+			steps:   []step{start(0), answer(0, "Stockholm"), answer(1, "Stockholm"), timeUp(), answer(0, "Stockholm"), answer(1, "Stokolm"), acceptAnswer(0, "Stokolm"), acceptAnswer(0, "Stokolm")},
+			scores:  []int{5, 5},
+			streaks: []int{2, 2},
+		},
+		{
+			name:    "only the leader can accept",
+			steps:   []step{start(0), answer(0, "Stockholm"), answer(1, "Stockholm"), timeUp(), answer(0, "Stockholm"), answer(1, "Stokolm"), acceptAnswer(1, "Stokolm")},
+			scores:  []int{5, 1},
+			streaks: []int{2, 0},
+		},
+		{
+			name:    "accepting is only possible in the results",
+			steps:   []step{start(0), answer(0, "Stockholm"), answer(1, "Stockholm"), timeUp(), answer(1, "Stokolm"), acceptAnswer(0, "Stokolm")},
+			scores:  []int{2, 2},
+			streaks: []int{1, 1},
+			err:     "wrong_scene",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, players := newTestRoom(t, 2, "alice", "bob")
+			r.Settings.Scoring = []string{"negative", "streak"}
+			for _, question := range r.Questions {
+				question.Kind = FreeTextQuestion
+				question.Choices = []string{}
+				question.CorrectChoice = "Stockholm"
+			}
+			runSteps(r, players, tt.steps)
+
+			for i, player := range players {
+				if player.Score != tt.scores[i] || player.streak != tt.streaks[i] {
+					t.Errorf("%s score = %d with streak %d, want %d with streak %d", player.Name, player.Score, player.streak, tt.scores[i], tt.streaks[i])
+				}
+			}
+			if code := lastError(players[0]); code != tt.err {
+				t.Errorf("leader last error = %q, want %q", code, tt.err)
+			}
+			// Once accepted, the answer is scored as if it was correct from the start
+			if points := r.Questions[1].Points[players[1]]; tt.streaks[1] == 2 && points.Bonuses["negative"] != 0 {
+				t.Errorf("accepted answer kept the negative bonus %d", points.Bonuses["negative"])
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package game
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Length of generated room IDs
+	roomIDLength = 4
+
+	// Default time a room without any activity is kept alive.
+	DefaultIdleTTL = 30 * time.Minute
+
+	// Default time a finished room is kept alive.
+	DefaultFinishedTTL = 5 * time.Minute
+
+	// How often expired rooms are looked for.
+	reapInterval = time.Minute
+)
+
+var roomIDLetters = []rune("ABCDEFGHJKLMNPQRSTUVWXYZ123456789")
+
+// Manager holds every running room. It is safe for concurrent use.
+type Manager struct {
+	IdleTTL     time.Duration
+	FinishedTTL time.Duration
+
+	mu       sync.Mutex
+	rooms    map[string]*Room
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewManager(idleTTL time.Duration, finishedTTL time.Duration) *Manager {
+	return &Manager{
+		IdleTTL:     idleTTL,
+		FinishedTTL: finishedTTL,
+		rooms:       make(map[string]*Room),
+		quit:        make(chan struct{}),
+	}
+}
+
+// Create registers a new room with a unique ID and starts its Run goroutine. configure (if
+// not nil) sets the room up before it can be found by ID or Run is started.
+func (m *Manager) Create(configure func(room *Room)) *Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var roomID string
+	for ok := true; ok; _, ok = m.rooms[roomID] {
+		roomID = randomRoomID()
+	}
+	room := NewRoom(roomID)
+	if configure != nil {
+		configure(room)
+	}
+	m.rooms[roomID] = room
+	go room.Run()
+
+	log.Debug().Msg("Room [" + roomID + "]: Created")
+	return room
+}
+
+func (m *Manager) Get(roomID string) (*Room, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[roomID]
+	return room, ok
+}
+
+// Delete removes the room and waits for it to shut down.
+func (m *Manager) Delete(roomID string) {
+	m.mu.Lock()
+	room, ok := m.rooms[roomID]
+	delete(m.rooms, roomID)
+	m.mu.Unlock()
+
+	if ok {
+		room.Stop()
+		log.Debug().Msg("Deleted room [" + roomID + "]")
+	}
+}
+
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.rooms)
+}
+
+// Reap deletes every room that has been idle longer than IdleTTL or finished longer than FinishedTTL.
+func (m *Manager) Reap() {
+	now := time.Now()
+	var expired []*Room
+
+	m.mu.Lock()
+	for roomID, room := range m.rooms {
+		finishedAt := room.FinishedAt()
+		if (!finishedAt.IsZero() && now.Sub(finishedAt) > m.FinishedTTL) || now.Sub(room.LastActive()) > m.IdleTTL {
+			delete(m.rooms, roomID)
+			expired = append(expired, room)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, room := range expired {
+		room.Stop()
+		log.Debug().Msg("Deleted expired room [" + room.ID + "]")
+	}
+}
+
+// StartReaper periodically reaps expired rooms until Shutdown is called.
+func (m *Manager) StartReaper() {
+	go func() {
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Reap()
+			case <-m.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the reaper, if started, and every room.
+func (m *Manager) Shutdown() {
+	m.stopOnce.Do(func() { close(m.quit) })
+
+	m.mu.Lock()
+	rooms := m.rooms
+	m.rooms = make(map[string]*Room)
+	m.mu.Unlock()
+
+	for _, room := range rooms {
+		room.Stop()
+	}
+}
+
+func randomRoomID() string {
+	s := make([]rune, roomIDLength)
+	for i := range s {
+		s[i] = roomIDLetters[rand.Intn(len(roomIDLetters))]
+	}
+	return string(s)
+}
@@ -0,0 +1,126 @@
+package game
+
+import "errors"
+
+type GameMode int
+
+const (
+	// Players are rewarded for picking the question's CorrectChoice
+	ClassicMode GameMode = iota
+	// Players are rewarded for picking the most voted choice
+	MajorityMode
+)
+
+// How majority questions are scored when several choices share the most votes
+type TieMode int
+
+const (
+	// Every player that picked one of the tied choices is rewarded
+	TieAllWin TieMode = iota
+	// Nobody is rewarded
+	TieNoneWin
+	// One of the tied choices is picked at random
+	TieRandom
+)
+
+func ParseGameMode(s string) (GameMode, error) {
+	switch s {
+	case "", "classic":
+		return ClassicMode, nil
+	case "majority":
+		return MajorityMode, nil
+	}
+	return ClassicMode, errors.New("unknown game mode " + s)
+}
+
+func (m GameMode) String() string {
+	if m == MajorityMode {
+		return "majority"
+	}
+	return "classic"
+}
+
+func ParseTieMode(s string) (TieMode, error) {
+	switch s {
+	case "", "all":
+		return TieAllWin, nil
+	case "none":
+		return TieNoneWin, nil
+	case "random":
+		return TieRandom, nil
+	}
+	return TieAllWin, errors.New("unknown tie mode " + s)
+}
+
+func (t TieMode) String() string {
+	switch t {
+	case TieNoneWin:
+		return "none"
+	case TieRandom:
+		return "random"
+	}
+	return "all"
+}
+
+// How the answer of a team is picked from its members' votes
+type TeamAnswerMode int
+
+const (
+	// The first vote of a member is the team's answer, the rest of the team can not vote
+	TeamAnswerFirst TeamAnswerMode = iota
+	// The captain's vote is the team's answer, the others only advise. If the captain does
+	// not vote, the team's majority is used.
+	TeamAnswerCaptain
+	// The choice most voted by the members, ties go to the choice voted first
+	TeamAnswerMajority
+)
+
+func ParseTeamAnswerMode(s string) (TeamAnswerMode, error) {
+	switch s {
+	case "", "first":
+		return TeamAnswerFirst, nil
+	case "captain":
+		return TeamAnswerCaptain, nil
+	case "majority":
+		return TeamAnswerMajority, nil
+	}
+	return TeamAnswerFirst, errors.New("unknown team answer mode " + s)
+}
+
+func (t TeamAnswerMode) String() string {
+	switch t {
+	case TeamAnswerCaptain:
+		return "captain"
+	case TeamAnswerMajority:
+		return "majority"
+	}
+	return "first"
+}
+
+// How numeric estimation questions are scored in classic mode
+type EstimateMode int
+
+const (
+	// The closest guesses earn the full points
+	EstimateClosest EstimateMode = iota
+	// Every guess earns points in proportion to how close it is, nothing when off by the
+	// answer itself or more
+	EstimateProportional
+)
+
+func ParseEstimateMode(s string) (EstimateMode, error) {
+	switch s {
+	case "", "closest":
+		return EstimateClosest, nil
+	case "proportional":
+		return EstimateProportional, nil
+	}
+	return EstimateClosest, errors.New("unknown estimate mode " + s)
+}
+
+func (e EstimateMode) String() string {
+	if e == EstimateProportional {
+		return "proportional"
+	}
+	return "closest"
+}
@@ -0,0 +1,153 @@
+package game
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// formatNumber formats a numeric guess so that it parses back to the same number.
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// addNumberAnswer returns the choice the guess belongs to, adding it as a new choice unless
+// the same number has been guessed before.
+func (q *Question) addNumberAnswer(n float64) int {
+	guess := formatNumber(n)
+	for i, choice := range q.Choices {
+		if choice == guess {
+			return i
+		}
+	}
+	q.Choices = append(q.Choices, guess)
+	return len(q.Choices) - 1
+}
+
+// choiceNumber returns the guess of a numeric question's choice.
+func (q *Question) choiceNumber(i int) float64 {
+	n, _ := strconv.ParseFloat(q.Choices[i], 64)
+	return n
+}
+
+// correctNumber returns the answer to a numeric question.
+func (q *Question) correctNumber() float64 {
+	n, _ := strconv.ParseFloat(q.CorrectChoice, 64)
+	return n
+}
+
+// guessError returns how far off the choice is from the answer.
+func (q *Question) guessError(i int) float64 {
+	return math.Abs(q.choiceNumber(i) - q.correctNumber())
+}
+
+// closestChoices returns the choices among guesses that are closest to the answer.
+func (q *Question) closestChoices(guesses []int) []int {
+	closest := []int{}
+	for _, guess := range guesses {
+		if len(closest) == 0 || q.guessError(guess) < q.guessError(closest[0]) {
+			closest = []int{guess}
+		} else if q.guessError(guess) == q.guessError(closest[0]) && !containsInt(closest, guess) {
+			closest = append(closest, guess)
+		}
+	}
+	return closest
+}
+
+// proportionalPoints returns the points a guess earns out of max, shrinking linearly with its
+// error relative to the answer.
+func (q *Question) proportionalPoints(i int, max int) int {
+	scale := math.Max(math.Abs(q.correctNumber()), 1)
+	closeness := 1 - q.guessError(i)/scale
+	if closeness <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(max) * closeness))
+}
+
+// scoreEstimate scores a numeric question by how close the guesses, or the teams' guesses, are.
+func (s *Scoring) scoreEstimate(points int) {
+	q := s.Question
+	guesses := []int{}
+	if s.TeamAnswers != nil {
+		for _, answer := range s.TeamAnswers {
+			guesses = append(guesses, answer)
+		}
+	} else {
+		for _, vote := range q.Answers {
+			guesses = append(guesses, vote)
+		}
+	}
+	if s.Estimate == EstimateClosest {
+		s.Winners = q.closestChoices(guesses)
+		s.awardWinners(points)
+		return
+	}
+
+	s.Winners = []int{}
+	for _, guess := range guesses {
+		if q.proportionalPoints(guess, points) > 0 && !containsInt(s.Winners, guess) {
+			s.Winners = append(s.Winners, guess)
+		}
+	}
+	for team, answer := range s.TeamAnswers {
+		team.Score += q.proportionalPoints(answer, points)
+	}
+	for player, vote := range q.Answers {
+		if s.Correct(player) {
+			s.Award(player, q.proportionalPoints(vote, points))
+			q.CorrectPlayers = append(q.CorrectPlayers, player)
+		} else {
+			q.IncorrectPlayers = append(q.IncorrectPlayers, player)
+		}
+	}
+}
+
+type JSONGuess struct {
+	Name   string  `json:"name"`
+	Number float64 `json:"number"`
+	// How far off the guess is from the answer
+	Error float64 `json:"error"`
+}
+
+// JSONDistribution summarizes the guesses to a numeric question.
+type JSONDistribution struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	// Every guess, the closest first
+	Guesses []*JSONGuess `json:"guesses"`
+}
+
+// toJSONDistribution builds the distribution of the guesses, nil if nobody guessed.
+func (q *Question) toJSONDistribution() *JSONDistribution {
+	if len(q.Answers) == 0 {
+		return nil
+	}
+	distribution := &JSONDistribution{Guesses: []*JSONGuess{}}
+	numbers := []float64{}
+	for player, vote := range q.Answers {
+		n := q.choiceNumber(vote)
+		numbers = append(numbers, n)
+		distribution.Guesses = append(distribution.Guesses, &JSONGuess{Name: player.Name, Number: n, Error: q.guessError(vote)})
+	}
+	sort.Slice(distribution.Guesses, func(i, j int) bool {
+		a, b := distribution.Guesses[i], distribution.Guesses[j]
+		return a.Error < b.Error || (a.Error == b.Error && a.Name < b.Name)
+	})
+	sort.Float64s(numbers)
+
+	sum := 0.0
+	for _, n := range numbers {
+		sum += n
+	}
+	distribution.Min = numbers[0]
+	distribution.Max = numbers[len(numbers)-1]
+	distribution.Mean = sum / float64(len(numbers))
+	distribution.Median = numbers[len(numbers)/2]
+	if len(numbers)%2 == 0 {
+		distribution.Median = (numbers[len(numbers)/2-1] + numbers[len(numbers)/2]) / 2
+	}
+	return distribution
+}
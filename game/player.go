@@ -1,8 +1,9 @@
 package game
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -20,12 +21,19 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer, enough to send back the full settings.
+	maxMessageSize = 4096
 )
 
 var (
 	newline = []byte{'\n'}
+
+	ErrNameTaken  = errors.New("name already taken")
+	ErrRoomFull   = errors.New("room is full")
+	ErrBanned     = errors.New("banned from room")
+	ErrRoomClosed = errors.New("room is closed")
+	// Returned when a session token does not match any player in the room
+	ErrInvalidSession = errors.New("invalid session")
 )
 
 var upgrader = websocket.Upgrader{
@@ -34,40 +42,61 @@ var upgrader = websocket.Upgrader{
 }
 
 type Player struct {
-	Name     string
-	Score    int
-	IsLeader bool
-	Room     *Room
-	Conn     *websocket.Conn
-	send     chan []byte
+	Name  string
+	Score int
+	// Points earned and rounds won over every round played in the room
+	TotalScore int
+	Wins       int
+	IsLeader   bool
+	Room       *Room
+	Conn       *websocket.Conn
+	// nil while the player is disconnected
+	send chan []byte
+	// Token letting the player reattach a new connection to this seat
+	session string
+	// When the player lost their connection, zero while connected
+	disconnectedAt time.Time
+	// Order in which the player joined the room
+	joinSeq int
+	// Score when the current round started
+	roundStartScore int
+	// The player's team, nil if teams are off
+	team *Team
+	// Number of questions in a row the player has answered correctly, kept by StreakRule
+	streak int
+	// Lives left in survival, and whether the player has run out and only watches the game
+	Lives      int
+	Eliminated bool
+	// Spectators watch the room without playing, they are kept in Room.Spectators
+	spectator bool
+	// Set for spectators that want the presentation view, e.g. a big screen
+	presentation bool
 }
 
 type JSONPlayer struct {
-	Name     string `json:"name"`
-	Score    int    `json:"score"`
-	IsLeader bool   `json:"isLeader"`
-}
-
-type PlayerAction struct {
-	Action string `json:"action"`
-	Value  int    `json:"value"`
+	Name       string `json:"name"`
+	Score      int    `json:"score"`
+	TotalScore int    `json:"total_score"`
+	Wins       int    `json:"wins"`
+	IsLeader   bool   `json:"isLeader"`
+	Connected  bool   `json:"connected"`
+	// ID of the player's team, left out if teams are off
+	Team int `json:"team,omitempty"`
+	// Lives left and whether the player is out, left out unless playing survival
+	Lives      int  `json:"lives,omitempty"`
+	Eliminated bool `json:"eliminated,omitempty"`
 }
 
 func (p *Player) ToJSONPlayer() *JSONPlayer {
-	return &JSONPlayer{Name: p.Name, Score: p.Score, IsLeader: p.IsLeader}
+	jsonPlayer := &JSONPlayer{Name: p.Name, Score: p.Score, TotalScore: p.TotalScore, Wins: p.Wins, IsLeader: p.IsLeader, Connected: p.IsConnected(), Lives: p.Lives, Eliminated: p.Eliminated}
+	if p.team != nil {
+		jsonPlayer.Team = p.team.ID
+	}
+	return jsonPlayer
 }
 
-func (p *Player) Vote(vote int) {
-	question := p.Room.Questions[p.Room.CurrentQuestion]
-	if _, ok := question.Answers[p]; !ok && p.Room.Scene == 1 {
-		if p.Room.CurrentQuestion >= len(p.Room.Questions) {
-			return
-		}
-
-		question.Answers[p] = vote
-		// TODO: Needed for seeing who voted?
-		p.Room.BroadcastRoomState()
-	}
+func (p *Player) IsConnected() bool {
+	return p.send != nil
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -75,35 +104,35 @@ func (p *Player) Vote(vote int) {
 // The application runs readPump in a per-connection goroutine. The application
 // ensures that there is at most one reader on a connection by executing all
 // reads from this goroutine.
-func (p *Player) readPump() {
+func (p *Player) readPump(conn *websocket.Conn, send chan []byte) {
 	defer func() {
-		p.Room.unregister <- p
-		p.Conn.Close()
+		p.Room.post(disconnectEvent{player: p, send: send})
+		conn.Close()
 	}()
-	p.Conn.SetReadLimit(maxMessageSize)
-	p.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	p.Conn.SetPongHandler(func(string) error { p.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
-		action := PlayerAction{}
-		err := p.Conn.ReadJSON(&action)
+		_, raw, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Warn().Err(err).Msg("Room [" + p.Room.ID + "]: Player " + p.Name + " websocket closed unexpectedly")
 			}
-			log.Warn().Err(err).Msg("Room [" + p.Room.ID + "]: Could not read JSON message from player " + p.Name)
+			log.Warn().Err(err).Msg("Room [" + p.Room.ID + "]: Could not read message from player " + p.Name)
 			break
 		}
-		log.Debug().Msg("Room [" + p.Room.ID + "]: " + p.Name + " performed action {" + action.Action + "} with value " + fmt.Sprint(action.Value))
-		if action.Action == "Vote" {
-			p.Vote(action.Value)
-		} else if action.Action == "Start" {
-			// Leader can start the game if the game is not yet started
-			// or if the game is over.
-			if p.IsLeader && (p.Room.Scene == 0 || p.Room.Scene == 3) {
-				go p.Room.StartGame()
-			}
+
+		// Invalid messages are reported back to the player instead of dispatched
+		e, id, err := decodeMessage(p, raw)
+		if err != nil {
+			log.Debug().Err(err).Msg("Room [" + p.Room.ID + "]: Rejected message from " + p.Name)
+			e = rejectEvent{player: p, id: id, err: err}
+		} else {
+			log.Debug().Msg("Room [" + p.Room.ID + "]: " + p.Name + " sent " + string(raw))
+		}
+		if !p.Room.post(e) {
+			break
 		}
-		//p.Room.broadcast <- p.Room.ToJSON()
 	}
 }
 
@@ -112,72 +141,97 @@ func (p *Player) readPump() {
 // A goroutine running writePump is started for each connection. The
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
-func (p *Player) writePump() {
+func (p *Player) writePump(conn *websocket.Conn, send chan []byte) {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		p.Conn.Close()
+		conn.Close()
 	}()
 	for {
 		select {
-		case message, ok := <-p.send:
-			p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case message, ok := <-send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel.
-				p.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := p.Conn.NextWriter(websocket.TextMessage)
+			w, err := conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
 			}
 			w.Write(message)
 
 			// Add queued chat messages to the current websocket message.
-			// n := len(p.send)
+			// n := len(send)
 			// for i := 0; i < n; i++ {
 			// 	w.Write(newline)
-			// 	w.Write(<-p.send)
+			// 	w.Write(<-send)
 			// }
 
 			if err := w.Close(); err != nil {
 				return
 			}
 		case <-ticker.C:
-			p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := p.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
 	}
 }
 
-// serveWs handles websocket requests from the peer.
-func ServeWs(room *Room, isLeader bool, playerName string, w http.ResponseWriter, r *http.Request) error {
-	// if name is already taken
-	for p := range room.Players {
-		if p.Name == playerName {
-			return errors.New("name already taken")
-		}
+// serveWs handles websocket requests from the peer. If session matches a player in the
+// room, the connection is reattached to that player instead of joining as a new one.
+func ServeWs(room *Room, isLeader bool, playerName string, session string, w http.ResponseWriter, r *http.Request) error {
+	return serve(room, joinEvent{name: playerName, isLeader: isLeader, session: session}, w, r)
+}
+
+// ServeWatch connects a spectator to the room. Spectators receive the room updates but can
+// not play, presentation adds the timer and vote data needed by a big screen display.
+func ServeWatch(room *Room, presentation bool, w http.ResponseWriter, r *http.Request) error {
+	return serve(room, joinEvent{spectator: true, presentation: presentation}, w, r)
+}
+
+func serve(room *Room, join joinEvent, w http.ResponseWriter, r *http.Request) error {
+	// The room validates the join and reserves the seat before the connection is upgraded
+	result := make(chan joinResult, 1)
+	join.result = result
+	if !room.post(join) {
+		return ErrRoomClosed
+	}
+	joined := <-result
+	if joined.err != nil {
+		return joined.err
 	}
+	player := joined.player
 
 	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Error().Err(err).Msg("Could not upgrade websocket connection")
+		if join.spectator || join.session != "" {
+			room.post(disconnectEvent{player: player, send: joined.send})
+		} else {
+			// Nobody is waiting to reconnect to a seat that was never connected
+			room.post(abandonedEvent{player: player, send: joined.send})
+		}
 		return err
 	}
-	if playerName == "" {
-		playerName = "Player " + fmt.Sprint(len(room.Players)+1)
-	}
-
-	player := &Player{Room: room, Score: 0, IsLeader: isLeader, Conn: conn, send: make(chan []byte, 256), Name: playerName}
-	player.Room.register <- player
+	player.Conn = conn
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
-	go player.writePump()
-	go player.readPump()
+	go player.writePump(conn, joined.send)
+	go player.readPump(conn, joined.send)
 	return nil
 }
+
+func newSessionToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Error().Err(err).Msg("Could not generate session token")
+	}
+	return hex.EncodeToString(b)
+}
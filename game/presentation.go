@@ -0,0 +1,60 @@
+package game
+
+// JSONPresentation is the extra state sent to spectators watching with the presentation
+// view, enough for a big screen to draw timers and animate the reveal of the results.
+type JSONPresentation struct {
+	// When the current scene's timer runs out, in unix milliseconds, and how long it was set
+	// for, in milliseconds. Both are zero if the scene is not timed.
+	TimerEnds     int64 `json:"timer_ends,omitempty"`
+	TimerDuration int64 `json:"timer_duration,omitempty"`
+	// Number of players that have answered the current question, or placed their stake or
+	// written their bluff, and that are expected to
+	Answered int `json:"answered"`
+	Voters   int `json:"voters"`
+	// Number of votes and names of the voters for each choice, only in the results scene
+	VoteCounts []int      `json:"vote_counts,omitempty"`
+	Votes      [][]string `json:"votes,omitempty"`
+}
+
+// presentation builds the presentation view for viewer, nil if they did not ask for it.
+func (r *Room) presentation(viewer *Player) *JSONPresentation {
+	if viewer == nil || !viewer.presentation {
+		return nil
+	}
+	presentation := &JSONPresentation{}
+	if !r.timerEnds.IsZero() {
+		presentation.TimerEnds = r.timerEnds.UnixMilli()
+		presentation.TimerDuration = r.timerDuration.Milliseconds()
+	}
+	for player := range r.Players {
+		if player.IsConnected() && !player.Eliminated {
+			presentation.Voters++
+		}
+	}
+	switch r.Scene {
+	case SceneWager:
+		presentation.Answered = len(r.Questions[r.CurrentQuestion].Stakes)
+	case SceneBluff:
+		presentation.Answered = len(r.Questions[r.CurrentQuestion].Bluffs)
+	}
+	if r.Scene != SceneQuestion && r.Scene != SceneResults {
+		return presentation
+	}
+
+	question := r.Questions[r.CurrentQuestion]
+	presentation.Answered = len(question.Answers)
+	if r.Scene == SceneResults {
+		presentation.VoteCounts = make([]int, len(question.Choices))
+		presentation.Votes = make([][]string, len(question.Choices))
+		for i := range presentation.Votes {
+			presentation.Votes[i] = []string{}
+		}
+		for player, vote := range question.Answers {
+			if vote >= 0 && vote < len(question.Choices) {
+				presentation.VoteCounts[vote]++
+				presentation.Votes[vote] = append(presentation.Votes[vote], player.Name)
+			}
+		}
+	}
+	return presentation
+}
@@ -0,0 +1,287 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ProtocolVersion is the version of the websocket message protocol, see PROTOCOL.md.
+// Messages in both directions are wrapped in a Message envelope.
+const ProtocolVersion = 1
+
+// Message types sent by clients
+const (
+	MessageVote           = "vote"
+	MessageAnswer         = "answer"
+	MessageAcceptAnswer   = "accept_answer"
+	MessageStart          = "start"
+	MessageTransferLeader = "transfer_leader"
+	MessageSync           = "sync"
+	MessageUpdateSettings = "update_settings"
+	MessagePlayAgain      = "play_again"
+	MessageKick           = "kick"
+	MessageBan            = "ban"
+	MessageAssignTeam     = "assign_team"
+	MessageBalanceTeams   = "balance_teams"
+	MessageWager          = "wager"
+	MessageBluff          = "bluff"
+)
+
+// Message types sent by the server
+const (
+	MessageState = "state"
+	MessageAck   = "ack"
+	MessageError = "error"
+	// Sent to a player that has been kicked or banned, before their connection is closed
+	MessageRemoved = "removed"
+)
+
+type Message struct {
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	// Set by the client on requests, echoed in the matching ack or error
+	ID string `json:"id,omitempty"`
+	// Sequence number of room updates sent by the server
+	Seq     int             `json:"seq,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// VotePayload is the payload of vote and accept_answer
+type VotePayload struct {
+	Choice *int `json:"choice"`
+}
+
+// AnswerPayload is the payload of answer, text for free text questions and number for
+// numeric ones, and of bluff
+type AnswerPayload struct {
+	Text   string   `json:"text,omitempty"`
+	Number *float64 `json:"number,omitempty"`
+}
+
+// PlayAgainPayload is the optional payload of start and play_again
+type PlayAgainPayload struct {
+	ResetScores bool `json:"reset_scores"`
+}
+
+// TargetPayload is the payload of transfer_leader, kick and ban
+type TargetPayload struct {
+	Target string `json:"target"`
+}
+
+type AssignTeamPayload struct {
+	Target string `json:"target"`
+	Team   int    `json:"team"`
+}
+
+type RemovedPayload struct {
+	Reason string `json:"reason"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ActionError is sent to the client when a message is invalid or can not be performed.
+type ActionError struct {
+	Code    string
+	Message string
+}
+
+func (e *ActionError) Error() string {
+	return e.Message
+}
+
+type WagerPayload struct {
+	Amount *int `json:"amount"`
+}
+
+var (
+	ErrBadMessage         = &ActionError{Code: "bad_message", Message: "message is not valid JSON"}
+	ErrUnsupportedVersion = &ActionError{Code: "unsupported_version", Message: "unsupported protocol version"}
+	ErrUnknownType        = &ActionError{Code: "unknown_type", Message: "unknown message type"}
+	ErrBadPayload         = &ActionError{Code: "bad_payload", Message: "invalid payload for message type"}
+	ErrNotLeader          = &ActionError{Code: "not_leader", Message: "only the leader can do that"}
+	ErrWrongScene         = &ActionError{Code: "wrong_scene", Message: "not possible in the current scene"}
+	ErrAlreadyVoted       = &ActionError{Code: "already_voted", Message: "already voted on this question"}
+	ErrInvalidChoice      = &ActionError{Code: "invalid_choice", Message: "no such choice"}
+	ErrUnknownPlayer      = &ActionError{Code: "unknown_player", Message: "no such player"}
+	ErrNoQuestions        = &ActionError{Code: "no_questions", Message: "no playable questions"}
+	ErrBusy               = &ActionError{Code: "busy", Message: "fetching questions, try again shortly"}
+	ErrSpectator          = &ActionError{Code: "spectator", Message: "spectators can only watch"}
+	ErrUnknownTeam        = &ActionError{Code: "unknown_team", Message: "no such team"}
+	ErrTeamAnswered       = &ActionError{Code: "team_answered", Message: "your team has already answered"}
+	ErrWrongAnswerKind    = &ActionError{Code: "wrong_answer_kind", Message: "use vote for choice and bluff questions, answer with text for free text questions and answer with number for numeric questions"}
+	ErrInvalidAnswer      = &ActionError{Code: "invalid_answer", Message: "answer is empty or too long"}
+	ErrNotAcceptable      = &ActionError{Code: "not_acceptable", Message: "only free text answers can be accepted, in classic mode"}
+	ErrAlreadyWagered     = &ActionError{Code: "already_wagered", Message: "already placed a stake on this question"}
+	ErrInvalidWager       = &ActionError{Code: "invalid_wager", Message: "stake must be between 0 and your score"}
+	ErrAlreadyBluffed     = &ActionError{Code: "already_bluffed", Message: "already wrote a bluff for this question"}
+	ErrBluffIsTruth       = &ActionError{Code: "bluff_is_truth", Message: "your bluff is too close to the real answer"}
+	ErrOwnBluff           = &ActionError{Code: "own_bluff", Message: "you can not vote for your own bluff"}
+	ErrEliminated         = &ActionError{Code: "eliminated", Message: "you have been eliminated, wait for the next game"}
+
+	// Returned by a handler that will reply once it is done, e.g. after fetching questions
+	errDeferred = errors.New("reply deferred")
+)
+
+// A decoder validates a message payload and turns it into an event for the room
+type decoder func(p *Player, id string, payload json.RawMessage) (event, error)
+
+var decoders = map[string]decoder{
+	MessageVote: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v VotePayload
+		if err := decodePayload(payload, &v); err != nil || v.Choice == nil {
+			return nil, ErrBadPayload
+		}
+		return voteEvent{player: p, id: id, vote: *v.Choice}, nil
+	},
+	MessageAnswer: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v AnswerPayload
+		if err := decodePayload(payload, &v); err != nil {
+			return nil, ErrBadPayload
+		}
+		return answerEvent{player: p, id: id, text: v.Text, number: v.Number}, nil
+	},
+	MessageBluff: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v AnswerPayload
+		if err := decodePayload(payload, &v); err != nil || v.Number != nil {
+			return nil, ErrBadPayload
+		}
+		return bluffEvent{player: p, id: id, text: v.Text}, nil
+	},
+	MessageWager: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v WagerPayload
+		if err := decodePayload(payload, &v); err != nil || v.Amount == nil {
+			return nil, ErrBadPayload
+		}
+		return wagerEvent{player: p, id: id, amount: *v.Amount}, nil
+	},
+	MessageAcceptAnswer: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v VotePayload
+		if err := decodePayload(payload, &v); err != nil || v.Choice == nil {
+			return nil, ErrBadPayload
+		}
+		return acceptAnswerEvent{player: p, id: id, choice: *v.Choice}, nil
+	},
+	MessageStart: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v PlayAgainPayload
+		if len(payload) > 0 && decodePayload(payload, &v) != nil {
+			return nil, ErrBadPayload
+		}
+		return startEvent{player: p, id: id, resetScores: v.ResetScores}, nil
+	},
+	MessagePlayAgain: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v PlayAgainPayload
+		if len(payload) > 0 && decodePayload(payload, &v) != nil {
+			return nil, ErrBadPayload
+		}
+		return playAgainEvent{player: p, id: id, resetScores: v.ResetScores}, nil
+	},
+	MessageTransferLeader: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v TargetPayload
+		if err := decodePayload(payload, &v); err != nil || v.Target == "" {
+			return nil, ErrBadPayload
+		}
+		return transferLeaderEvent{player: p, id: id, target: v.Target}, nil
+	},
+	MessageUpdateSettings: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v JSONSettings
+		if err := decodePayload(payload, &v); err != nil {
+			return nil, ErrBadPayload
+		}
+		return updateSettingsEvent{player: p, id: id, update: &v}, nil
+	},
+	MessageKick: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v TargetPayload
+		if err := decodePayload(payload, &v); err != nil || v.Target == "" {
+			return nil, ErrBadPayload
+		}
+		return removeEvent{player: p, id: id, target: v.Target, reason: ReasonKicked}, nil
+	},
+	MessageBan: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v TargetPayload
+		if err := decodePayload(payload, &v); err != nil || v.Target == "" {
+			return nil, ErrBadPayload
+		}
+		return removeEvent{player: p, id: id, target: v.Target, reason: ReasonBanned}, nil
+	},
+	MessageAssignTeam: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		var v AssignTeamPayload
+		if err := decodePayload(payload, &v); err != nil || v.Target == "" {
+			return nil, ErrBadPayload
+		}
+		return assignTeamEvent{player: p, id: id, target: v.Target, team: v.Team}, nil
+	},
+	MessageBalanceTeams: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		return balanceTeamsEvent{player: p, id: id}, nil
+	},
+	MessageSync: func(p *Player, id string, payload json.RawMessage) (event, error) {
+		return syncEvent{player: p, id: id}, nil
+	},
+}
+
+// decodeMessage validates a raw client message and turns it into an event. The
+// returned id is the message's request id, if it could be read.
+func decodeMessage(p *Player, raw []byte) (event, string, error) {
+	var msg Message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, "", ErrBadMessage
+	}
+	if msg.Version != ProtocolVersion {
+		return nil, msg.ID, ErrUnsupportedVersion
+	}
+	decode, ok := decoders[msg.Type]
+	if !ok {
+		return nil, msg.ID, ErrUnknownType
+	}
+	if p.spectator && msg.Type != MessageSync {
+		return nil, msg.ID, ErrSpectator
+	}
+	e, err := decode(p, msg.ID, msg.Payload)
+	return e, msg.ID, err
+}
+
+func decodePayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		return errors.New("missing payload")
+	}
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+func encodeMessage(msgType string, id string, seq int, payload interface{}) []byte {
+	msg := Message{Version: ProtocolVersion, Type: msgType, ID: id, Seq: seq}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal " + msgType + " payload to JSON")
+		}
+		msg.Payload = b
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal " + msgType + " message to JSON")
+	}
+	return b
+}
+
+// reply acknowledges the request id, or sends the error if the action failed.
+func (r *Room) reply(player *Player, id string, err error) {
+	if err == errDeferred {
+		return
+	}
+	if err != nil {
+		var actionErr *ActionError
+		if !errors.As(err, &actionErr) {
+			actionErr = &ActionError{Code: "internal", Message: err.Error()}
+		}
+		r.sendTo(player, encodeMessage(MessageError, id, 0, &ErrorPayload{Code: actionErr.Code, Message: actionErr.Message}))
+	} else if id != "" {
+		r.sendTo(player, encodeMessage(MessageAck, id, 0, nil))
+	}
+}
@@ -1,57 +1,243 @@
 package game
 
+import (
+	"strings"
+	"time"
+)
+
 type Question struct {
-	Type             string
-	Category         string
-	Description      string
-	Choices          []string
-	CorrectChoice    string
+	Type        string
+	Category    string
+	Difficulty  string
+	Description string
+	Kind        QuestionKind
+	// The choices to vote for. Free text and numeric questions start without choices, see
+	// FreeTextQuestion.
+	Choices       []string
+	CorrectChoice string
+	// Other accepted spellings of a free text question's CorrectChoice
+	Aliases []string
+	// Free text answers the leader accepted as correct, by choice
+	Accepted         []int
 	Answers          map[*Player]int
 	Reward           int
 	CorrectPlayers   []*Player
 	IncorrectPlayers []*Player
+	// The most voted choices, set when the question is scored in majority mode
+	MajorityChoices []int
+	// Players that lost their last life on the question in survival
+	EliminatedPlayers []*Player
+	// Players filling the {1}, {2}... placeholders
+	Targets []*Player
+	// The answer each team was scored for, set when teams are scored
+	TeamAnswers map[*Team]int
+	// When the question was shown and each player answered it
+	AskedAt    time.Time
+	AnsweredAt map[*Player]time.Time
+	// Each player's points for the question, set when it is scored
+	Points map[*Player]*Points
+	// Players stake points on wager questions before they are shown, see WagerRule
+	Wager  bool
+	Stakes map[*Player]int
+	// Each player's fake answer to a bluff question
+	Bluffs map[*Player]string
+
+	// Players in the order they answered
+	answerOrder []*Player
+	// Set on the last question of a game when Settings.FinalWager is
+	finalWager bool
+
+	rawDescription string
+	rawChoices     []string
 }
 
 type JSONQuestion struct {
-	Type             string   `json:"type"`
-	Description      string   `json:"description"`
+	Type        string `json:"type"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	// The answers given so far for free text questions, only included once revealed
 	Choices          []string `json:"choices"`
-	CorrectChoice    string   `json:"correct_choice"`
+	CorrectChoice    string   `json:"correct_choice,omitempty"`
+	Aliases          []string `json:"aliases,omitempty"`
 	Reward           int      `json:"reward"`
 	Answers          []string `json:"answers"`
 	CorrectPlayers   []string `json:"correct_players"`
 	IncorrectPlayers []string `json:"incorrect_players"`
+	// The most voted choices in majority mode, only included once revealed
+	MajorityChoices []int `json:"majority_choices,omitempty"`
+	// Players eliminated by the question in survival, only included once revealed
+	EliminatedPlayers []string `json:"eliminated_players,omitempty"`
+	Targets           []string `json:"targets"`
+	// The recipient's own vote, if they have voted, or their answer to a free text or numeric
+	// question until revealed
+	Vote *int   `json:"vote,omitempty"`
+	Text string `json:"text,omitempty"`
+	// Votes, or free text answers, of the recipient's teammates so the team can agree on an answer
+	TeamVotes map[string]int    `json:"team_votes,omitempty"`
+	TeamTexts map[string]string `json:"team_texts,omitempty"`
+	// Free text answers accepted by the leader, and those close enough that they may want to
+	Accepted   []int `json:"accepted,omitempty"`
+	Borderline []int `json:"borderline,omitempty"`
+	// The answer of each team by name, only included once revealed
+	TeamAnswers map[string]int `json:"team_answers,omitempty"`
+	// Breakdown of the points earned by each player that answered, only included once revealed
+	Points map[string]*JSONPoints `json:"points,omitempty"`
+	// The guesses to a numeric question, only included once revealed
+	Distribution *JSONDistribution `json:"distribution,omitempty"`
+	// Set for wager questions. While stakes are placed only who has placed theirs is included,
+	// and the recipient's own stake. Every player's stake is included once revealed.
+	Wager   bool           `json:"wager,omitempty"`
+	Wagered []string       `json:"wagered,omitempty"`
+	Stake   *int           `json:"stake,omitempty"`
+	Stakes  map[string]int `json:"stakes,omitempty"`
+	// For bluff questions who has written their bluff, and the recipient's own bluff. The choice
+	// each player's bluff became is included once revealed.
+	Bluffed []string       `json:"bluffed,omitempty"`
+	Bluff   string         `json:"bluff,omitempty"`
+	Bluffs  map[string]int `json:"bluffs,omitempty"`
 }
 
-func (q *Question) ToJSONQuestion() *JSONQuestion {
-	correctPlayerNames := make([]string, len(q.CorrectPlayers))
-	for i, player := range q.CorrectPlayers {
-		correctPlayerNames[i] = player.Name
+// ToJSONQuestion builds the client view of the question. The correct choice and results are
+// only included if reveal is set, viewer (if any) gets to see their own vote.
+func (q *Question) ToJSONQuestion(reveal bool, viewer *Player) *JSONQuestion {
+	targetNames := make([]string, len(q.Targets))
+	for i, player := range q.Targets {
+		targetNames[i] = player.Name
 	}
-	incorrectPlayerNames := make([]string, len(q.IncorrectPlayers))
-	for i, player := range q.IncorrectPlayers {
-		incorrectPlayerNames[i] = player.Name
-	}
-	answers := make([]string, len(q.Answers))
+	answers := make([]string, 0, len(q.Answers))
 	for p := range q.Answers {
 		answers = append(answers, p.Name)
 	}
+	jsonQuestion := &JSONQuestion{Type: q.Type, Kind: q.Kind.String(), Description: q.Description, Choices: q.Choices, Reward: q.Reward, Answers: answers, CorrectPlayers: []string{}, IncorrectPlayers: []string{}, Targets: targetNames, Wager: q.isWager()}
+	// Free text answers and guesses would give the answer away to the players that have not
+	// answered yet
+	hidden := (q.Kind == FreeTextQuestion || q.Kind == NumericQuestion) && !reveal
+	if hidden {
+		jsonQuestion.Choices = []string{}
+	}
+	if stake, ok := q.Stakes[viewer]; ok && viewer != nil {
+		jsonQuestion.Stake = &stake
+	}
+	if q.Kind == BluffQuestion {
+		jsonQuestion.Bluffed = []string{}
+		for player := range q.Bluffs {
+			jsonQuestion.Bluffed = append(jsonQuestion.Bluffed, player.Name)
+		}
+		if viewer != nil {
+			jsonQuestion.Bluff = q.Bluffs[viewer]
+		}
+	}
+	if vote, ok := q.Answers[viewer]; ok && viewer != nil {
+		if hidden {
+			jsonQuestion.Text = q.Choices[vote]
+		} else {
+			jsonQuestion.Vote = &vote
+		}
+	}
+	if viewer != nil && viewer.team != nil {
+		jsonQuestion.TeamVotes = make(map[string]int)
+		jsonQuestion.TeamTexts = make(map[string]string)
+		for player, vote := range q.Answers {
+			if player.team != viewer.team || player == viewer {
+				continue
+			}
+			if hidden {
+				jsonQuestion.TeamTexts[player.Name] = q.Choices[vote]
+			} else {
+				jsonQuestion.TeamVotes[player.Name] = vote
+			}
+		}
+	}
+	if !reveal {
+		return jsonQuestion
+	}
+
+	if q.Kind == FreeTextQuestion {
+		jsonQuestion.Aliases = q.Aliases
+		jsonQuestion.Accepted = q.Accepted
+		jsonQuestion.Borderline = q.borderlineChoices()
+	}
+	if q.Kind == NumericQuestion {
+		jsonQuestion.Distribution = q.toJSONDistribution()
+	}
+	if q.Kind == BluffQuestion {
+		jsonQuestion.Bluffs = make(map[string]int, len(q.Bluffs))
+		for i := range q.Choices {
+			for _, author := range q.bluffAuthors(i) {
+				jsonQuestion.Bluffs[author.Name] = i
+			}
+		}
+	}
+	if q.isWager() {
+		jsonQuestion.Stakes = make(map[string]int, len(q.Stakes))
+		for player, stake := range q.Stakes {
+			jsonQuestion.Stakes[player.Name] = stake
+		}
+	}
 
-	return &JSONQuestion{Type: q.Type, Description: q.Description, Choices: q.Choices, CorrectChoice: q.CorrectChoice, Reward: q.Reward, Answers: answers, CorrectPlayers: correctPlayerNames, IncorrectPlayers: incorrectPlayerNames}
+	if q.TeamAnswers != nil {
+		jsonQuestion.TeamAnswers = make(map[string]int, len(q.TeamAnswers))
+		for team, answer := range q.TeamAnswers {
+			jsonQuestion.TeamAnswers[team.Name] = answer
+		}
+	}
+	jsonQuestion.CorrectChoice = q.CorrectChoice
+	jsonQuestion.MajorityChoices = q.MajorityChoices
+	// Questions without an answer of their own show the majority as the correct choice
+	if q.CorrectChoice == "" && len(q.MajorityChoices) > 0 {
+		winningChoices := make([]string, len(q.MajorityChoices))
+		for i, winner := range q.MajorityChoices {
+			winningChoices[i] = q.Choices[winner]
+		}
+		jsonQuestion.CorrectChoice = strings.Join(winningChoices, ", ")
+	}
+	jsonQuestion.Points = q.toJSONPoints()
+	for _, player := range q.CorrectPlayers {
+		jsonQuestion.CorrectPlayers = append(jsonQuestion.CorrectPlayers, player.Name)
+	}
+	for _, player := range q.IncorrectPlayers {
+		jsonQuestion.IncorrectPlayers = append(jsonQuestion.IncorrectPlayers, player.Name)
+	}
+	for _, player := range q.EliminatedPlayers {
+		jsonQuestion.EliminatedPlayers = append(jsonQuestion.EliminatedPlayers, player.Name)
+	}
+	return jsonQuestion
+}
+
+// reset clears the answers and results so the question can be asked again.
+func (q *Question) reset() {
+	q.Answers = make(map[*Player]int)
+	q.Targets = nil
+	q.AskedAt = time.Time{}
+	q.AnsweredAt = nil
+	q.answerOrder = nil
+	q.Stakes = nil
+	q.Bluffs = nil
+	q.finalWager = false
+	if q.Kind != ChoiceQuestion {
+		q.Choices = []string{}
+		q.Accepted = nil
+	}
+	q.clearResults()
 }
 
-func (q *Question) AwardScores() {
-	//log.Debug().Msgf("Awarding scores for answer %s", q.CorrectChoice)
+// clearResults clears what scoring the question set, so it can be scored again.
+func (q *Question) clearResults() {
+	q.CorrectPlayers = nil
+	q.IncorrectPlayers = nil
+	q.MajorityChoices = nil
+	q.EliminatedPlayers = nil
+	q.TeamAnswers = nil
+	q.Points = nil
+}
 
-	answerIndex := indexOfAnswer(q)
-	for player, vote := range q.Answers {
-		if vote == answerIndex {
-			player.Score += q.Reward * 2
-			q.CorrectPlayers = append(q.CorrectPlayers, player)
-		} else {
-			q.IncorrectPlayers = append(q.IncorrectPlayers, player)
+func containsInt(s []int, v int) bool {
+	for _, e := range s {
+		if e == v {
+			return true
 		}
 	}
+	return false
 }
 
 func indexOfAnswer(q *Question) int {
@@ -1,85 +1,276 @@
 package game
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"crypto/subtle"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+type Scene int
+
+const (
+	SceneLobby Scene = iota
+	SceneQuestion
+	SceneResults
+	SceneGameOver
+	// Players stake points on the next question before it is shown, see Question.Wager
+	SceneWager
+	// Players write fake answers to the question before voting, see BluffQuestion
+	SceneBluff
+)
+
+const (
+	// Default time the results of a question are shown before moving on.
+	DefaultResultsDuration = 15 * time.Second
+	// Default time a disconnected player's seat is kept.
+	DefaultReconnectGrace = 60 * time.Second
+)
+
 type Room struct {
-	ID              string
-	Players         map[*Player]bool
-	Questions       []*Question
-	NQuestions      int
+	ID      string
+	Players map[*Player]bool
+	// Connections watching the room without playing
+	Spectators map[*Player]bool
+	// Teams the players are split into, empty unless Settings.Teams is set
+	Teams     []*Team
+	Questions []*Question
+	Settings  Settings
+	// Fetches new questions when the settings change, may be nil
+	Source          QuestionSource
 	CurrentQuestion int
-	// 0 = not started, 1 = question time, 2 = question results, 3 = game over
-	Scene  int
-	Active bool
+	// 0 = not started, 1 = question time, 2 = question results, 3 = game over, 4 = wagering, 5 = bluffing
+	Scene Scene
+	// Number of rounds started in the room
+	Round int
+	// When the current question's answer time runs out, zero if there is no limit
+	Deadline time.Time
+	// Time a disconnected player's seat and score are kept for them to reconnect
+	ReconnectGrace time.Duration
+	// Number of times each player has been the target of a {1}/{2} question
+	targetCounts map[*Player]int
+	// Number of players that have joined, used to order them by seniority
+	joinSeq int
+	// Number of spectators that have joined, used to name them
+	spectatorSeq int
+	// Sequence number of the latest broadcast update
+	seq int
+	// Set when the settings have changed so that Questions must be fetched again
+	questionsStale bool
+	// Set while questions are being fetched from Source
+	fetching bool
+	// Lower case names of banned players, they can not join again
+	banned map[string]bool
+	// Scores from before the current question was scored, so it can be scored again
+	scoredFrom *scoreSnapshot
+	// Set when the current game started with a single player, survival then goes on until
+	// they are eliminated
+	startedAlone bool
+	// Connections whose send buffer filled up, disconnected after the current event
+	overflowed []disconnectEvent
+	// SHA-256 of the room password, nil if the room is open. Only set before the room is
+	// registered with the Manager, so it is read without locking.
+	passwordHash []byte
+
+	// Events from the clients and timers, handled by the Run goroutine.
+	events chan event
+	// Pending scene timer, timerSeq identifies it so stale timer events can be ignored.
+	timer    *time.Timer
+	timerSeq int
+	// When the pending timer fires and how long it was set for, shown in the presentation view
+	timerEnds     time.Time
+	timerDuration time.Duration
+	// Closed to stop the Run goroutine.
+	quit     chan struct{}
+	stopOnce sync.Once
+	// Closed once the Run goroutine has returned.
+	done chan struct{}
 
-	// Inbound messages from the clients.
-	broadcast chan []byte
-	// Register requests from the clients.
-	register chan *Player
-	// Unregister requests from clients.
-	unregister chan *Player
-	// Kill room if true
-	kill chan bool
+	// Guards lastActive and finishedAt, which are read by the room manager.
+	mu         sync.Mutex
+	lastActive time.Time
+	finishedAt time.Time
 }
 
 type JSONRoom struct {
 	ID              string          `json:"id"`
 	Players         []*JSONPlayer   `json:"players"`
+	Teams           []*JSONTeam     `json:"teams,omitempty"`
 	Questions       []*JSONQuestion `json:"questions"`
 	CurrentQuestion int             `json:"current_question"`
-	Scene           int             `json:"scene"`
+	Mode            string          `json:"mode"`
+	Settings        *JSONSettings   `json:"settings"`
+	Scene           Scene           `json:"scene"`
+	Round           int             `json:"round"`
+	HasPassword     bool            `json:"has_password"`
+	// Answer, wager or bluff deadline and the server's current time, in unix milliseconds
+	Deadline   int64 `json:"deadline,omitempty"`
+	ServerTime int64 `json:"server_time"`
+	// The recipient's session token, used to reconnect with /join?session=
+	Session string `json:"session,omitempty"`
+	// Only sent to spectators watching with the presentation view
+	Presentation *JSONPresentation `json:"presentation,omitempty"`
 }
 
 func NewRoom(roomID string) *Room {
 	return &Room{
-		broadcast:       make(chan []byte),
-		register:        make(chan *Player),
-		unregister:      make(chan *Player),
+		events:          make(chan event),
 		Players:         make(map[*Player]bool),
+		Spectators:      make(map[*Player]bool),
 		ID:              roomID,
 		Questions:       []*Question{},
-		NQuestions:      15,
+		Settings:        DefaultSettings(),
 		CurrentQuestion: 0,
-		Scene:           0,
-		Active:          true,
+		Scene:           SceneLobby,
+		ReconnectGrace:  DefaultReconnectGrace,
+		targetCounts:    make(map[*Player]int),
+		banned:          make(map[string]bool),
+		quit:            make(chan struct{}),
+		done:            make(chan struct{}),
+		lastActive:      time.Now(),
 	}
 }
 
-func (r *Room) ToJSON() []byte {
-	jsonRoom := &JSONRoom{ID: r.ID, Players: []*JSONPlayer{}, Questions: []*JSONQuestion{}, CurrentQuestion: r.CurrentQuestion, Scene: r.Scene}
+// ToJSONRoom builds the room state as seen by viewer. Only questions that have been reached are
+// included, and the current question's answer is hidden until the results scene.
+func (r *Room) ToJSONRoom(viewer *Player) *JSONRoom {
+	jsonRoom := &JSONRoom{ID: r.ID, Players: []*JSONPlayer{}, Teams: r.toJSONTeams(), Questions: []*JSONQuestion{}, CurrentQuestion: r.CurrentQuestion, Mode: r.Settings.Mode.String(), Settings: r.Settings.ToJSONSettings(), Scene: r.Scene, Round: r.Round, HasPassword: r.passwordHash != nil, ServerTime: time.Now().UnixMilli()}
+	if viewer != nil {
+		jsonRoom.Session = viewer.session
+		jsonRoom.Presentation = r.presentation(viewer)
+	}
+	if r.timedScene() && !r.Deadline.IsZero() {
+		jsonRoom.Deadline = r.Deadline.UnixMilli()
+	}
 
 	for player := range r.Players {
 		jsonRoom.Players = append(jsonRoom.Players, player.ToJSONPlayer())
 	}
-	for _, question := range r.Questions {
-		jsonRoom.Questions = append(jsonRoom.Questions, question.ToJSONQuestion())
+	if r.Scene != SceneLobby {
+		for i := 0; i <= r.CurrentQuestion && i < len(r.Questions); i++ {
+			if i == r.CurrentQuestion && r.Scene == SceneWager {
+				jsonRoom.Questions = append(jsonRoom.Questions, r.Questions[i].toJSONWager(viewer))
+				continue
+			}
+			reveal := i < r.CurrentQuestion || r.Scene == SceneResults || r.Scene == SceneGameOver
+			jsonRoom.Questions = append(jsonRoom.Questions, r.Questions[i].ToJSONQuestion(reveal, viewer))
+		}
+	}
+	return jsonRoom
+}
+
+// SetPassword protects the room with a password, an empty password opens it. It must be
+// called before the room is shared with other goroutines, e.g. when configuring it in
+// Manager.Create.
+func (r *Room) SetPassword(password string) {
+	if password == "" {
+		r.passwordHash = nil
+		return
+	}
+	hash := sha256.Sum256([]byte(password))
+	r.passwordHash = hash[:]
+}
+
+// CheckPassword reports whether the password lets a player join the room.
+func (r *Room) CheckPassword(password string) bool {
+	if r.passwordHash == nil {
+		return true
+	}
+	hash := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(hash[:], r.passwordHash) == 1
+}
+
+// touch marks the room as active, postponing its idle expiry.
+func (r *Room) touch() {
+	r.mu.Lock()
+	r.lastActive = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Room) markFinished() {
+	r.mu.Lock()
+	r.finishedAt = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Room) clearFinished() {
+	r.mu.Lock()
+	r.finishedAt = time.Time{}
+	r.mu.Unlock()
+}
+
+// LastActive returns the time of the last player activity in the room.
+func (r *Room) LastActive() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastActive
+}
+
+// FinishedAt returns when the room's game ended, or the zero time if it has not.
+func (r *Room) FinishedAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.finishedAt
+}
+
+func (r *Room) IsFinished() bool {
+	return !r.FinishedAt().IsZero()
+}
+
+// Stop shuts down the Run goroutine, closing every player connection, and waits for it to return.
+func (r *Room) Stop() {
+	r.stopOnce.Do(func() { close(r.quit) })
+	<-r.done
+}
+
+// post hands the event to the Run goroutine. Returns false if the room has been stopped.
+func (r *Room) post(e event) bool {
+	select {
+	case r.events <- e:
+		return true
+	case <-r.done:
+		return false
 	}
+}
 
-	b, err := json.Marshal(jsonRoom)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal room to JSON")
+// schedule posts a timer event after d, replacing any pending timer.
+func (r *Room) schedule(d time.Duration) {
+	r.cancelTimer()
+	seq := r.timerSeq
+	r.timer = time.AfterFunc(d, func() { r.post(timerEvent{seq: seq}) })
+	r.timerEnds = time.Now().Add(d)
+	r.timerDuration = d
+}
+
+func (r *Room) cancelTimer() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
 	}
-	return b
+	r.timerSeq++
+	r.timerEnds = time.Time{}
+	r.timerDuration = 0
 }
 
 func (r *Room) AddPlayer(player *Player) {
+	r.broadcast(MessagePlayerJoined, &PlayerPayload{Player: player.ToJSONPlayer()})
 	r.Players[player] = true
 	log.Debug().Msg("Room [" + r.ID + "]: Added " + player.Name)
-	r.BroadcastRoomState()
+	r.sendSnapshot(player)
 }
 
-func (r *Room) RemovePlayer(player *Player) {
+func (r *Room) RemovePlayer(player *Player, reason string) {
 	if _, ok := r.Players[player]; ok {
 		delete(r.Players, player)
-		close(player.send)
-		log.Debug().Msg("Room [" + r.ID + "]: Removed " + player.Name)
-		r.BroadcastRoomState()
+		delete(r.targetCounts, player)
+		if player.send != nil {
+			close(player.send)
+		}
+		log.Debug().Msg("Room [" + r.ID + "]: Removed " + player.Name + " (" + reason + ")")
+		r.broadcast(MessagePlayerLeft, &PlayerLeftPayload{Name: player.Name, Reason: reason})
 	}
 }
 
@@ -98,120 +289,235 @@ func (r *Room) shuffleQuestions() {
 	}
 }
 
+// NextQuestion advances to the next question that can be templated with the current players.
 func (r *Room) NextQuestion() *Question {
-	if r.CurrentQuestion >= len(r.Questions)-1 {
-		return nil
+	for r.CurrentQuestion < len(r.Questions)-1 {
+		r.CurrentQuestion++
+		if r.prepareQuestion(r.Questions[r.CurrentQuestion]) {
+			return r.Questions[r.CurrentQuestion]
+		}
+		log.Debug().Msg("Room [" + r.ID + "]: Skipping question (" + r.Questions[r.CurrentQuestion].Description + "), not enough players")
 	}
-	r.CurrentQuestion++
+	return nil
+}
 
-	return r.Questions[r.CurrentQuestion]
+// playableQuestions returns the questions that do not need more targets than there are players.
+func (r *Room) playableQuestions() []*Question {
+	playable := []*Question{}
+	for _, question := range r.Questions {
+		if question.RequiredTargets() <= len(r.Players) {
+			playable = append(playable, question)
+		}
+	}
+	return playable
 }
 
-func (r *Room) ResetGame() {
-	r.Scene = 0
+// ResetGame returns the room to the lobby for another round, keeping the players, their
+// standings and the leader. Scores are only reset if resetScores is set.
+func (r *Room) ResetGame(resetScores bool) {
+	r.cancelTimer()
+	r.Scene = SceneLobby
 	r.CurrentQuestion = 0
+	r.Deadline = time.Time{}
 	for _, question := range r.Questions {
-		question.Answers = make(map[*Player]int)
+		question.reset()
+	}
+	for player := range r.Players {
+		if resetScores {
+			player.Score = 0
+		}
+		player.roundStartScore = player.Score
+		player.streak = 0
+		player.Lives = 0
+		player.Eliminated = false
+	}
+	for _, team := range r.Teams {
+		if resetScores {
+			team.Score = 0
+		}
+		team.roundStartScore = team.Score
+		team.streak = 0
+	}
+	// A fresh set of questions is fetched for the next round
+	if r.Source != nil {
+		r.questionsStale = true
 	}
+	r.clearFinished()
 }
 
-func (r *Room) BroadcastRoomState() {
+// finishRound adds the points of the round to each player's standings. In survival the
+// players left standing win the round.
+func (r *Room) finishRound() {
+	best := 0
 	for player := range r.Players {
-		select {
-		case player.send <- r.ToJSON():
-		default:
-			close(player.send)
-			delete(r.Players, player)
+		if points := player.Score - player.roundStartScore; points > best {
+			best = points
 		}
 	}
+	for player := range r.Players {
+		points := player.Score - player.roundStartScore
+		player.TotalScore += points
+		if r.survival() {
+			if !player.Eliminated {
+				player.Wins++
+			}
+		} else if best > 0 && points == best {
+			player.Wins++
+		}
+		player.roundStartScore = player.Score
+	}
+
+	bestTeam := 0
+	for _, team := range r.Teams {
+		if points := team.Score - team.roundStartScore; points > bestTeam {
+			bestTeam = points
+		}
+	}
+	for _, team := range r.Teams {
+		points := team.Score - team.roundStartScore
+		team.TotalScore += points
+		if bestTeam > 0 && points == bestTeam {
+			team.Wins++
+		}
+		team.roundStartScore = team.Score
+	}
 }
 
-func (r *Room) StartGame() {
-	r.shuffleQuestions()
-	r.selectNQuestions(r.NQuestions)
-	r.Scene = 1
-	r.BroadcastRoomState()
+// answerTime returns the time limit for the question, 0 if there is none.
+func (r *Room) answerTime(question *Question) time.Duration {
+	if d, ok := r.Settings.AnswerTimeByType[question.Type]; ok {
+		return d
+	}
+	return r.Settings.AnswerTime
+}
 
-	prevScene := 0
-	for {
-		if len(r.Players) == 0 {
-			log.Debug().Msg("Room [" + r.ID + "]: No players left, killing room...")
-			r.Active = false
-			r.kill <- true
-			return
-		}
+// timedScene reports whether the current scene runs until Deadline, if one is set.
+func (r *Room) timedScene() bool {
+	return r.Scene == SceneQuestion || r.Scene == SceneWager || r.Scene == SceneBluff
+}
 
-		// Move to results screen if every player has answered
-		if len(r.Questions[r.CurrentQuestion].Answers) == len(r.Players) && r.Scene == 1 && len(r.Players) > 0 { // TODO: Remove len(r.Players) > 0
-			r.Scene = 2
-			//r.BroadcastRoomState()
-		}
-		// If scene has changed, broadcast the new scene
-		if r.Scene != prevScene {
-			switch r.Scene {
-			case 0:
-				prevScene = 0
-			// Question time
-			case 1:
-				prevScene = 1
-				log.Debug().Msg("Room [" + r.ID + "]: Starting question (" + r.Questions[r.CurrentQuestion].Description + ")")
-			// Question results
-			case 2:
-				prevScene = 2
-				log.Debug().Msg("Room [" + r.ID + "]: Displaying results for (" + r.Questions[r.CurrentQuestion].Description + ")")
-				r.Questions[r.CurrentQuestion].AwardScores()
-				r.BroadcastRoomState()
-				time.Sleep(time.Second * 15)
-				if r.NextQuestion() == nil {
-					r.Scene = 3
-				} else {
-					r.Scene = 1
-				}
-			// Game over
-			case 3:
-				prevScene = 3
-				log.Debug().Msg("Room [" + r.ID + "]: Game over")
-				r.Active = false
-				//time.Sleep(time.Second * 5)
+// scoreSnapshot holds the scores and streaks of the players and teams, and the players'
+// lives, at one point in time.
+type scoreSnapshot struct {
+	players map[*Player][3]int
+	teams   map[*Team][2]int
+}
+
+func (r *Room) snapshotScores() *scoreSnapshot {
+	snapshot := &scoreSnapshot{players: make(map[*Player][3]int), teams: make(map[*Team][2]int)}
+	for player := range r.Players {
+		snapshot.players[player] = [3]int{player.Score, player.streak, player.Lives}
+	}
+	for _, team := range r.Teams {
+		snapshot.teams[team] = [2]int{team.Score, team.streak}
+	}
+	return snapshot
+}
+
+func (r *Room) restoreScores(snapshot *scoreSnapshot) {
+	for player, values := range snapshot.players {
+		player.Score, player.streak, player.Lives = values[0], values[1], values[2]
+		player.Eliminated = r.survival() && player.Lives == 0
+	}
+	for team, values := range snapshot.teams {
+		team.Score, team.streak = values[0], values[1]
+	}
+}
+
+// rescore scores the current question again, e.g. after the leader accepted an answer.
+func (r *Room) rescore() {
+	question := r.Questions[r.CurrentQuestion]
+	r.restoreScores(r.scoredFrom)
+	question.clearResults()
+	r.awardScores(question)
+}
+
+// awardScores scores the question with the rule of the game mode, followed by the rules
+// selected in the settings. Bluff questions are scored with BluffRule, and wager questions
+// with WagerRule, last.
+func (r *Room) awardScores(question *Question) {
+	r.scoredFrom = r.snapshotScores()
+	scoring := &Scoring{Question: question, Players: []*Player{}, Tie: r.Settings.TieMode, Estimate: r.Settings.Estimate, Window: r.answerTime(question)}
+	if scoring.Window == 0 {
+		scoring.Window = DefaultSpeedWindow
+	}
+	for player := range r.Players {
+		scoring.Players = append(scoring.Players, player)
+	}
+	if len(r.Teams) > 0 {
+		scoring.coveredByTeam = make(map[*Player]bool)
+		for player := range r.Players {
+			if _, ok := question.Answers[player]; !ok && r.hasAnswered(player, question) {
+				scoring.coveredByTeam[player] = true
 			}
-			// TODO: Should it work like this?
-			if r.Scene == 3 {
-				r.Active = false
-				r.BroadcastRoomState()
-				log.Debug().Msg("Room [" + r.ID + "]: Shutting down...")
-				r.kill <- true
-				break
+		}
+		scoring.TeamAnswers = make(map[*Team]int)
+		for _, team := range r.Teams {
+			if answer, ok := r.teamAnswer(team, question); ok {
+				scoring.TeamAnswers[team] = answer
 			}
-			r.BroadcastRoomState()
 		}
-		time.Sleep(500 * time.Millisecond)
+		question.TeamAnswers = scoring.TeamAnswers
+	}
+	rules := r.Settings.scoringRules()
+	if question.Kind == BluffQuestion {
+		// Only the truth is correct, whatever the game mode
+		rules[0] = ClassicRule{}
+		rules = append(rules, BluffRule{})
+	}
+	if question.isWager() {
+		rules = append(rules, WagerRule{})
+	}
+	for _, rule := range rules {
+		rule.Score(scoring)
+	}
+
+	// Players that did not answer in time are counted as incorrect, unless their team
+	// answered for them
+	for player := range r.Players {
+		if _, ok := question.Answers[player]; !ok && !player.Eliminated && !scoring.coveredByTeam[player] {
+			question.IncorrectPlayers = append(question.IncorrectPlayers, player)
+		}
 	}
+	r.takeLives(question)
 }
 
+// sendTo queues a message for the player, if they are connected.
+func (r *Room) sendTo(player *Player, message []byte) {
+	if !player.IsConnected() {
+		return
+	}
+	select {
+	case player.send <- message:
+	default:
+		// Too slow to keep up, the player may reconnect. They are disconnected once the current
+		// event is handled, so the broadcast in progress is not interleaved with the updates
+		// the disconnect sends.
+		r.overflowed = append(r.overflowed, disconnectEvent{player: player, send: player.send})
+	}
+}
+
+// Run owns the room state, every change to it is made by handling an event here.
 func (r *Room) Run() {
+	defer close(r.done)
 	for {
 		select {
-		case player := <-r.register:
-			r.AddPlayer(player)
-		case player := <-r.unregister:
-			if r.Scene != 3 {
-				r.RemovePlayer(player)
-			}
-		case message := <-r.broadcast:
+		case e := <-r.events:
+			r.handle(e)
+		case <-r.quit:
+			log.Debug().Msg("Room [" + r.ID + "]: Shutting down...")
+			r.cancelTimer()
 			for player := range r.Players {
-				select {
-				case player.send <- message:
-				default:
+				if player.send != nil {
 					close(player.send)
-					delete(r.Players, player)
 				}
+				delete(r.Players, player)
 			}
-		// TODO: This never triggers?
-		case kill := <-r.kill:
-			if kill {
-				log.Debug().Msg("Room [" + r.ID + "]: Trying to kill...")
-				return
+			for spectator := range r.Spectators {
+				close(spectator.send)
+				delete(r.Spectators, spectator)
 			}
+			return
 		}
 	}
 }
@@ -0,0 +1,357 @@
+package game
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Time over which the speed bonus runs out for questions without an answer time limit
+const DefaultSpeedWindow = 20 * time.Second
+
+// A ScoringRule awards, or adjusts, the points for a question once its answers are in. Every
+// room scores with the rule of its game mode followed by the rules selected in its settings.
+type ScoringRule interface {
+	// Name identifies the rule in the scoring setting and in the points breakdown
+	Name() string
+	Score(s *Scoring)
+}
+
+// Rules selectable with the scoring setting, by name
+var scoringRules = map[string]ScoringRule{}
+
+// Rules deciding who earns points, by game mode
+var modeRules = map[GameMode]ScoringRule{
+	ClassicMode:  ClassicRule{},
+	MajorityMode: MajorityRule{},
+}
+
+func init() {
+	RegisterScoringRule(SpeedRule{})
+	RegisterScoringRule(StreakRule{})
+	RegisterScoringRule(NegativeRule{})
+}
+
+// RegisterScoringRule makes the rule selectable with the scoring setting.
+func RegisterScoringRule(rule ScoringRule) {
+	scoringRules[rule.Name()] = rule
+}
+
+// ScoringRuleNames returns the names of the selectable rules, sorted.
+func ScoringRuleNames() []string {
+	names := make([]string, 0, len(scoringRules))
+	for name := range scoringRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Scoring is a question being scored, rules award points through it so the points
+// breakdown is kept up to date.
+type Scoring struct {
+	Question *Question
+	// Every player in the room, including those that did not answer
+	Players []*Player
+	// Each team's answer, nil if teams are off
+	TeamAnswers map[*Team]int
+	Tie         TieMode
+	Estimate    EstimateMode
+	// Time players had to answer, DefaultSpeedWindow if there was no limit
+	Window time.Duration
+	// Choices that earn points, set by the game mode's rule
+	Winners []int
+	// Players that did not vote but were answered for by their team, see Room.hasAnswered
+	coveredByTeam map[*Player]bool
+}
+
+// Correct reports whether the player's own vote is one of the winners, with teams it must
+// also be their team's answer. Players without a vote are never correct, callers handle
+// players answered for by their team (coveredByTeam) themselves.
+func (s *Scoring) Correct(player *Player) bool {
+	vote, ok := s.Question.Answers[player]
+	if !ok {
+		return false
+	}
+	if s.TeamAnswers != nil {
+		answer, ok := s.TeamAnswers[player.team]
+		return ok && vote == answer && containsInt(s.Winners, answer)
+	}
+	return containsInt(s.Winners, vote)
+}
+
+// Award gives the player base points for their answer.
+func (s *Scoring) Award(player *Player, points int) {
+	s.Question.points(player).Base += points
+	player.Score += points
+}
+
+// Bonus gives the player extra points, or takes points if negative, under the rule's name.
+func (s *Scoring) Bonus(player *Player, rule string, points int) {
+	breakdown := s.Question.points(player)
+	if breakdown.Bonuses == nil {
+		breakdown.Bonuses = make(map[string]int)
+	}
+	breakdown.Bonuses[rule] += points
+	player.Score += points
+}
+
+// awardWinners gives points to every team with a winning answer, and every player with a
+// winning answer or that voted for their team's.
+func (s *Scoring) awardWinners(points int) {
+	for team, answer := range s.TeamAnswers {
+		if containsInt(s.Winners, answer) {
+			team.Score += points
+		}
+	}
+	q := s.Question
+	for player := range q.Answers {
+		if s.Correct(player) {
+			s.Award(player, points)
+			q.CorrectPlayers = append(q.CorrectPlayers, player)
+		} else {
+			q.IncorrectPlayers = append(q.IncorrectPlayers, player)
+		}
+	}
+}
+
+// ClassicRule rewards picking the question's CorrectChoice, or a matching free text answer,
+// with twice its reward. Numeric guesses are rewarded by closeness, see EstimateMode.
+type ClassicRule struct{}
+
+func (ClassicRule) Name() string { return "classic" }
+
+func (ClassicRule) Score(s *Scoring) {
+	if s.Question.Kind == NumericQuestion {
+		s.scoreEstimate(s.Question.Reward * 2)
+		return
+	}
+	s.Winners = s.Question.correctChoices()
+	s.awardWinners(s.Question.Reward * 2)
+}
+
+// MajorityRule rewards picking the most voted choice, with teams each team answer is one
+// vote. The winning choice(s) are stored in MajorityChoices so clients can display them,
+// CorrectChoice keeps the question's own answer.
+type MajorityRule struct{}
+
+func (MajorityRule) Name() string { return "majority" }
+
+func (MajorityRule) Score(s *Scoring) {
+	q := s.Question
+	votes := []int{}
+	if s.TeamAnswers != nil {
+		for _, answer := range s.TeamAnswers {
+			votes = append(votes, answer)
+		}
+	} else {
+		for _, vote := range q.Answers {
+			votes = append(votes, vote)
+		}
+	}
+
+	s.Winners = majorityWinners(len(q.Choices), votes, s.Tie)
+	q.MajorityChoices = s.Winners
+	s.awardWinners(q.Reward)
+}
+
+// majorityWinners returns the most voted of n choices, broken by tie.
+func majorityWinners(n int, votes []int, tie TieMode) []int {
+	counts := make([]int, n)
+	for _, vote := range votes {
+		if vote >= 0 && vote < len(counts) {
+			counts[vote]++
+		}
+	}
+
+	winners := []int{}
+	mostVotes := 0
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if n > mostVotes {
+			mostVotes = n
+			winners = []int{i}
+		} else if n == mostVotes {
+			winners = append(winners, i)
+		}
+	}
+	if len(winners) > 1 {
+		switch tie {
+		case TieNoneWin:
+			winners = []int{}
+		case TieRandom:
+			winners = []int{winners[rand.Intn(len(winners))]}
+		}
+	}
+	return winners
+}
+
+// SpeedRule gives every player that earned points a bonus of up to their points again,
+// shrinking linearly to nothing at the end of the answer time. A team earns the bonus of its
+// fastest member.
+type SpeedRule struct{}
+
+func (SpeedRule) Name() string { return "speed" }
+
+func (rule SpeedRule) Score(s *Scoring) {
+	teamBonus := make(map[*Team]int)
+	for player, points := range s.Question.Points {
+		remaining := s.Window - s.Question.answerTime(player)
+		if points.Base <= 0 || remaining <= 0 {
+			continue
+		}
+		bonus := int(math.Round(float64(points.Base) * float64(remaining) / float64(s.Window)))
+		s.Bonus(player, rule.Name(), bonus)
+		if player.team != nil && bonus > teamBonus[player.team] {
+			teamBonus[player.team] = bonus
+		}
+	}
+	for team, bonus := range teamBonus {
+		team.Score += bonus
+	}
+}
+
+// Most extra points the streak bonus can give, as a multiple of the base points
+const maxStreakMultiplier = 2
+
+// StreakRule rewards consecutive correct answers, adding half the base points for every
+// correct answer in a row before this one, up to maxStreakMultiplier times the base points.
+// Teams keep a streak of their own.
+type StreakRule struct{}
+
+func (StreakRule) Name() string { return "streak" }
+
+func (rule StreakRule) Score(s *Scoring) {
+	for _, player := range s.Players {
+		if s.coveredByTeam[player] {
+			// Their team's streak carries the answer
+			continue
+		}
+		if !s.Correct(player) {
+			player.streak = 0
+			continue
+		}
+		player.streak++
+		s.Bonus(player, rule.Name(), streakBonus(s.Question.points(player).Base, player.streak))
+	}
+	for _, team := range teamsOf(s.Players) {
+		answer, ok := s.TeamAnswers[team]
+		if !ok || !containsInt(s.Winners, answer) {
+			team.streak = 0
+			continue
+		}
+		team.streak++
+		team.Score += streakBonus(s.Question.Reward, team.streak)
+	}
+}
+
+func streakBonus(points int, streak int) int {
+	bonus := points * (streak - 1) / 2
+	if bonus > points*maxStreakMultiplier {
+		bonus = points * maxStreakMultiplier
+	}
+	return bonus
+}
+
+// NegativeRule takes the question's reward from every player, and team, that answered wrong.
+// Not answering costs nothing.
+type NegativeRule struct{}
+
+func (NegativeRule) Name() string { return "negative" }
+
+func (rule NegativeRule) Score(s *Scoring) {
+	for player := range s.Question.Answers {
+		if !s.Correct(player) {
+			s.Bonus(player, rule.Name(), -s.Question.Reward)
+		}
+	}
+	for team, answer := range s.TeamAnswers {
+		if !containsInt(s.Winners, answer) {
+			team.Score -= s.Question.Reward
+		}
+	}
+}
+
+// teamsOf returns the teams of the players, each once.
+func teamsOf(players []*Player) []*Team {
+	teams := []*Team{}
+	for _, player := range players {
+		if player.team != nil && !containsTeam(teams, player.team) {
+			teams = append(teams, player.team)
+		}
+	}
+	return teams
+}
+
+func containsTeam(teams []*Team, team *Team) bool {
+	for _, t := range teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// Points is a player's score breakdown for one question.
+type Points struct {
+	// Points for the answer itself
+	Base int
+	// Points added, or taken, by each scoring rule
+	Bonuses map[string]int
+}
+
+func (p *Points) Total() int {
+	total := p.Base
+	for _, bonus := range p.Bonuses {
+		total += bonus
+	}
+	return total
+}
+
+type JSONPoints struct {
+	Base    int            `json:"base"`
+	Bonuses map[string]int `json:"bonuses"`
+	Total   int            `json:"total"`
+	// Time taken to answer, in milliseconds
+	Time int64 `json:"time"`
+}
+
+// points returns the player's breakdown for the question, creating it if needed.
+func (q *Question) points(player *Player) *Points {
+	if q.Points == nil {
+		q.Points = make(map[*Player]*Points)
+	}
+	if q.Points[player] == nil {
+		q.Points[player] = &Points{}
+	}
+	return q.Points[player]
+}
+
+// answerTime returns how long the player took to answer, 0 if they have not.
+func (q *Question) answerTime(player *Player) time.Duration {
+	answeredAt, ok := q.AnsweredAt[player]
+	if !ok || q.AskedAt.IsZero() {
+		return 0
+	}
+	return answeredAt.Sub(q.AskedAt)
+}
+
+// toJSONPoints builds the breakdown of every player that answered the question, by name.
+func (q *Question) toJSONPoints() map[string]*JSONPoints {
+	jsonPoints := make(map[string]*JSONPoints, len(q.Answers))
+	for player := range q.Answers {
+		points := q.Points[player]
+		if points == nil {
+			points = &Points{}
+		}
+		bonuses := make(map[string]int, len(points.Bonuses))
+		for rule, bonus := range points.Bonuses {
+			bonuses[rule] = bonus
+		}
+		jsonPoints[player.Name] = &JSONPoints{Base: points.Base, Bonuses: bonuses, Total: points.Total(), Time: q.answerTime(player).Milliseconds()}
+	}
+	return jsonPoints
+}
@@ -0,0 +1,302 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultNQuestions = 15
+
+	// Time allowed to fetch the questions for a new room, or when the settings have changed
+	FetchTimeout = 15 * time.Second
+
+	maxNQuestions      = 100
+	maxAnswerTime      = 10 * time.Minute
+	minResultsDuration = time.Second
+	maxResultsDuration = 2 * time.Minute
+	maxPlayersLimit    = 100
+	minTeams           = 2
+	maxTeams           = 8
+	maxLives           = 10
+)
+
+var difficulties = []string{"easy", "medium", "hard"}
+
+// Settings configures a room. They can be changed by the leader while in the lobby.
+type Settings struct {
+	NQuestions int
+	// Comma separated question providers with optional amounts, e.g. "opentdb:10,trivia".
+	// Empty selects the default providers for the game mode.
+	Providers string
+	// Only use questions in these categories, empty means any
+	Categories []string
+	// Only use questions of this difficulty, empty means any
+	Difficulty string
+	// Time players have to answer each question, 0 means no limit
+	AnswerTime time.Duration
+	// Answer time overrides keyed by question type
+	AnswerTimeByType map[string]time.Duration
+	// Time the results of each question are shown
+	ResultsDuration time.Duration
+	Mode            GameMode
+	TieMode         TieMode
+	// Maximum number of players, 0 means no limit
+	MaxPlayers int
+	// Number of teams the players are split into, 0 means everyone plays for themselves
+	Teams      int
+	TeamAnswer TeamAnswerMode
+	// Names of the scoring rules applied after the game mode's, in order, see ScoringRule
+	Scoring []string
+	// How numeric questions are scored in classic mode
+	Estimate EstimateMode
+	// Make the last question of every game a wager question
+	FinalWager bool
+	// Lives each player starts survival with, 0 plays a normal game of NQuestions
+	Lives int
+}
+
+// JSONSettings is the wire format of Settings, times are in seconds. When used to update
+// settings, fields left out are not changed.
+type JSONSettings struct {
+	Questions        *int            `json:"questions,omitempty"`
+	Providers        *string         `json:"providers,omitempty"`
+	Categories       *[]string       `json:"categories,omitempty"`
+	Difficulty       *string         `json:"difficulty,omitempty"`
+	AnswerTime       *int            `json:"answer_time,omitempty"`
+	AnswerTimeByType *map[string]int `json:"answer_time_by_type,omitempty"`
+	ResultsTime      *int            `json:"results_time,omitempty"`
+	Mode             *string         `json:"mode,omitempty"`
+	Tie              *string         `json:"tie,omitempty"`
+	MaxPlayers       *int            `json:"max_players,omitempty"`
+	Teams            *int            `json:"teams,omitempty"`
+	TeamAnswer       *string         `json:"team_answer,omitempty"`
+	Scoring          *[]string       `json:"scoring,omitempty"`
+	Estimate         *string         `json:"estimate,omitempty"`
+	FinalWager       *bool           `json:"final_wager,omitempty"`
+	Lives            *int            `json:"lives,omitempty"`
+}
+
+// QuestionSource fetches the questions for a room's settings.
+type QuestionSource interface {
+	// Validate checks the question related settings, e.g. that the providers exist.
+	Validate(settings Settings) error
+	FetchQuestions(ctx context.Context, settings Settings) ([]*Question, error)
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		NQuestions:       DefaultNQuestions,
+		Categories:       []string{},
+		Scoring:          []string{},
+		AnswerTimeByType: make(map[string]time.Duration),
+		ResultsDuration:  DefaultResultsDuration,
+		Mode:             ClassicMode,
+		TieMode:          TieAllWin,
+	}
+}
+
+func (s Settings) ToJSONSettings() *JSONSettings {
+	byType := make(map[string]int, len(s.AnswerTimeByType))
+	for t, d := range s.AnswerTimeByType {
+		byType[t] = int(d / time.Second)
+	}
+	categories := append([]string{}, s.Categories...)
+	scoring := append([]string{}, s.Scoring...)
+	answerTime := int(s.AnswerTime / time.Second)
+	resultsTime := int(s.ResultsDuration / time.Second)
+	mode := s.Mode.String()
+	tie := s.TieMode.String()
+	teamAnswer := s.TeamAnswer.String()
+	estimate := s.Estimate.String()
+
+	return &JSONSettings{
+		Questions:        &s.NQuestions,
+		Providers:        &s.Providers,
+		Categories:       &categories,
+		Difficulty:       &s.Difficulty,
+		AnswerTime:       &answerTime,
+		AnswerTimeByType: &byType,
+		ResultsTime:      &resultsTime,
+		Mode:             &mode,
+		Tie:              &tie,
+		MaxPlayers:       &s.MaxPlayers,
+		Teams:            &s.Teams,
+		TeamAnswer:       &teamAnswer,
+		Scoring:          &scoring,
+		Estimate:         &estimate,
+		FinalWager:       &s.FinalWager,
+		Lives:            &s.Lives,
+	}
+}
+
+// Apply returns a copy of the settings with the fields set in update changed, or an error
+// if the result is not valid.
+func (s Settings) Apply(update *JSONSettings) (Settings, error) {
+	updated := s.copy()
+	if update.Questions != nil {
+		updated.NQuestions = *update.Questions
+	}
+	if update.Providers != nil {
+		updated.Providers = strings.TrimSpace(*update.Providers)
+	}
+	if update.Categories != nil {
+		updated.Categories = []string{}
+		for _, category := range *update.Categories {
+			if category = strings.TrimSpace(category); category != "" {
+				updated.Categories = append(updated.Categories, category)
+			}
+		}
+	}
+	if update.Difficulty != nil {
+		updated.Difficulty = strings.ToLower(strings.TrimSpace(*update.Difficulty))
+	}
+	if update.AnswerTime != nil {
+		updated.AnswerTime = time.Duration(*update.AnswerTime) * time.Second
+	}
+	if update.AnswerTimeByType != nil {
+		updated.AnswerTimeByType = make(map[string]time.Duration)
+		for t, seconds := range *update.AnswerTimeByType {
+			updated.AnswerTimeByType[t] = time.Duration(seconds) * time.Second
+		}
+	}
+	if update.ResultsTime != nil {
+		updated.ResultsDuration = time.Duration(*update.ResultsTime) * time.Second
+	}
+	if update.Mode != nil {
+		mode, err := ParseGameMode(*update.Mode)
+		if err != nil {
+			return s, invalidSettings(err.Error())
+		}
+		updated.Mode = mode
+	}
+	if update.Tie != nil {
+		tie, err := ParseTieMode(*update.Tie)
+		if err != nil {
+			return s, invalidSettings(err.Error())
+		}
+		updated.TieMode = tie
+	}
+	if update.MaxPlayers != nil {
+		updated.MaxPlayers = *update.MaxPlayers
+	}
+	if update.Teams != nil {
+		updated.Teams = *update.Teams
+	}
+	if update.TeamAnswer != nil {
+		teamAnswer, err := ParseTeamAnswerMode(*update.TeamAnswer)
+		if err != nil {
+			return s, invalidSettings(err.Error())
+		}
+		updated.TeamAnswer = teamAnswer
+	}
+	if update.Scoring != nil {
+		updated.Scoring = []string{}
+		for _, rule := range *update.Scoring {
+			if rule = strings.ToLower(strings.TrimSpace(rule)); rule != "" {
+				updated.Scoring = append(updated.Scoring, rule)
+			}
+		}
+	}
+	if update.Estimate != nil {
+		estimate, err := ParseEstimateMode(*update.Estimate)
+		if err != nil {
+			return s, invalidSettings(err.Error())
+		}
+		updated.Estimate = estimate
+	}
+	if update.FinalWager != nil {
+		updated.FinalWager = *update.FinalWager
+	}
+	if update.Lives != nil {
+		updated.Lives = *update.Lives
+	}
+
+	if err := updated.Validate(); err != nil {
+		return s, err
+	}
+	return updated, nil
+}
+
+// Validate checks that every setting is within its bounds.
+func (s Settings) Validate() error {
+	if s.NQuestions < 1 || s.NQuestions > maxNQuestions {
+		return invalidSettings(fmt.Sprintf("questions must be between 1 and %d", maxNQuestions))
+	}
+	if s.Difficulty != "" && !containsString(difficulties, s.Difficulty) {
+		return invalidSettings("difficulty must be one of " + strings.Join(difficulties, ", "))
+	}
+	if s.AnswerTime < 0 || s.AnswerTime > maxAnswerTime {
+		return invalidSettings(fmt.Sprintf("answer_time must be between 0 and %d", int(maxAnswerTime/time.Second)))
+	}
+	for t, d := range s.AnswerTimeByType {
+		if d < 0 || d > maxAnswerTime {
+			return invalidSettings("answer_time_by_type for " + t + " is out of range")
+		}
+	}
+	if s.ResultsDuration < minResultsDuration || s.ResultsDuration > maxResultsDuration {
+		return invalidSettings(fmt.Sprintf("results_time must be between %d and %d", int(minResultsDuration/time.Second), int(maxResultsDuration/time.Second)))
+	}
+	if s.MaxPlayers < 0 || s.MaxPlayers > maxPlayersLimit {
+		return invalidSettings(fmt.Sprintf("max_players must be between 0 and %d", maxPlayersLimit))
+	}
+	if s.Teams != 0 && (s.Teams < minTeams || s.Teams > maxTeams) {
+		return invalidSettings(fmt.Sprintf("teams must be 0 or between %d and %d", minTeams, maxTeams))
+	}
+	if s.Lives < 0 || s.Lives > maxLives {
+		return invalidSettings(fmt.Sprintf("lives must be between 0 and %d", maxLives))
+	}
+	if s.Lives > 0 && s.Teams > 0 {
+		return invalidSettings("lives can not be combined with teams")
+	}
+	for i, rule := range s.Scoring {
+		if _, ok := scoringRules[rule]; !ok {
+			return invalidSettings("unknown scoring rule " + rule + ", must be one of " + strings.Join(ScoringRuleNames(), ", "))
+		}
+		if containsString(s.Scoring[:i], rule) {
+			return invalidSettings("scoring rule " + rule + " is selected twice")
+		}
+	}
+	return nil
+}
+
+// questionsChanged reports whether the change from s to updated needs a new set of questions.
+func (s Settings) questionsChanged(updated Settings) bool {
+	return s.Providers != updated.Providers || s.Difficulty != updated.Difficulty ||
+		s.Mode != updated.Mode || strings.Join(s.Categories, ",") != strings.Join(updated.Categories, ",")
+}
+
+func (s Settings) copy() Settings {
+	c := s
+	c.Categories = append([]string{}, s.Categories...)
+	c.Scoring = append([]string{}, s.Scoring...)
+	c.AnswerTimeByType = make(map[string]time.Duration, len(s.AnswerTimeByType))
+	for t, d := range s.AnswerTimeByType {
+		c.AnswerTimeByType[t] = d
+	}
+	return c
+}
+
+// scoringRules returns the rules a question is scored with, the game mode's first.
+func (s Settings) scoringRules() []ScoringRule {
+	rules := []ScoringRule{modeRules[s.Mode]}
+	for _, name := range s.Scoring {
+		rules = append(rules, scoringRules[name])
+	}
+	return rules
+}
+
+func invalidSettings(message string) *ActionError {
+	return &ActionError{Code: "invalid_settings", Message: message}
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package game
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// Survival is played when Settings.Lives is set. Every player starts the game with that many
+// lives and loses one for each question they do not answer correctly. Players that run out
+// are eliminated and watch the rest of the game, which ends when at most one player is left.
+
+func (r *Room) survival() bool {
+	return r.Settings.Lives > 0
+}
+
+// startLives gives every player a full set of lives for a new game.
+func (r *Room) startLives() {
+	r.startedAlone = len(r.Players) == 1
+	for player := range r.Players {
+		player.Lives = r.Settings.Lives
+		player.Eliminated = false
+	}
+}
+
+// takeLives takes a life from every player still in the game that did not answer the
+// question correctly, eliminating those that run out.
+func (r *Room) takeLives(question *Question) {
+	if !r.survival() {
+		return
+	}
+	for player := range r.Players {
+		if player.Eliminated || containsPlayer(question.CorrectPlayers, player) {
+			continue
+		}
+		player.Lives--
+		if player.Lives <= 0 {
+			player.Lives = 0
+			player.Eliminated = true
+			question.EliminatedPlayers = append(question.EliminatedPlayers, player)
+			log.Debug().Msg("Room [" + r.ID + "]: " + player.Name + " was eliminated")
+		}
+	}
+}
+
+// survivors returns the number of players that have not been eliminated.
+func (r *Room) survivors() int {
+	n := 0
+	for player := range r.Players {
+		if !player.Eliminated {
+			n++
+		}
+	}
+	return n
+}
+
+// survivalOver reports whether the game is over because at most one player is left, or
+// none if the game started with a single player.
+func (r *Room) survivalOver() bool {
+	if !r.survival() {
+		return false
+	}
+	survivors := r.survivors()
+	return survivors == 0 || (survivors == 1 && !r.startedAlone)
+}
+
+func containsPlayer(players []*Player, player *Player) bool {
+	for _, p := range players {
+		if p == player {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// A Team answers each question as one, its score is earned by its members' votes.
+type Team struct {
+	ID   int
+	Name string
+	// Score for the current game, and points earned and rounds won over every round
+	Score      int
+	TotalScore int
+	Wins       int
+	// Score when the current round started
+	roundStartScore int
+	// Number of questions in a row the team has answered correctly, kept by StreakRule
+	streak int
+}
+
+type JSONTeam struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Score      int    `json:"score"`
+	TotalScore int    `json:"total_score"`
+	Wins       int    `json:"wins"`
+	// The member whose vote is the team's answer in captain mode
+	Captain string   `json:"captain,omitempty"`
+	Members []string `json:"members"`
+}
+
+func (r *Room) toJSONTeam(team *Team) *JSONTeam {
+	jsonTeam := &JSONTeam{ID: team.ID, Name: team.Name, Score: team.Score, TotalScore: team.TotalScore, Wins: team.Wins, Members: []string{}}
+	for _, member := range r.teamMembers(team) {
+		jsonTeam.Members = append(jsonTeam.Members, member.Name)
+	}
+	if captain := r.teamCaptain(team); captain != nil {
+		jsonTeam.Captain = captain.Name
+	}
+	return jsonTeam
+}
+
+func (r *Room) toJSONTeams() []*JSONTeam {
+	teams := make([]*JSONTeam, len(r.Teams))
+	for i, team := range r.Teams {
+		teams[i] = r.toJSONTeam(team)
+	}
+	return teams
+}
+
+// teamMembers returns the players in the team, the most senior first.
+func (r *Room) teamMembers(team *Team) []*Player {
+	members := []*Player{}
+	for player := range r.Players {
+		if player.team == team {
+			members = append(members, player)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].joinSeq < members[j].joinSeq })
+	return members
+}
+
+// teamCaptain returns the team's most senior member, nil if the team is empty.
+func (r *Room) teamCaptain(team *Team) *Player {
+	if members := r.teamMembers(team); len(members) > 0 {
+		return members[0]
+	}
+	return nil
+}
+
+func (r *Room) teamByID(id int) *Team {
+	for _, team := range r.Teams {
+		if team.ID == id {
+			return team
+		}
+	}
+	return nil
+}
+
+// SetupTeams replaces the teams with n new ones and balances the players between them,
+// n = 0 turns teams off. Outside of Run it must be called before the room is shared.
+func (r *Room) SetupTeams(n int) {
+	r.Teams = nil
+	for i := 1; i <= n; i++ {
+		r.Teams = append(r.Teams, &Team{ID: i, Name: fmt.Sprintf("Team %d", i)})
+	}
+	for player := range r.Players {
+		player.team = nil
+	}
+	r.balanceTeams()
+}
+
+// balanceTeams splits the players evenly between the teams at random.
+func (r *Room) balanceTeams() {
+	players := make([]*Player, 0, len(r.Players))
+	for player := range r.Players {
+		players = append(players, player)
+	}
+	rand.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+	for i, player := range players {
+		if len(r.Teams) > 0 {
+			player.team = r.Teams[i%len(r.Teams)]
+		}
+	}
+}
+
+// smallestTeam returns the team with the fewest members, nil if teams are off.
+func (r *Room) smallestTeam() *Team {
+	var smallest *Team
+	smallestSize := 0
+	for _, team := range r.Teams {
+		if size := len(r.teamMembers(team)); smallest == nil || size < smallestSize {
+			smallest, smallestSize = team, size
+		}
+	}
+	return smallest
+}
+
+// hasAnswered reports whether the player, or their team on their behalf, has answered.
+func (r *Room) hasAnswered(player *Player, question *Question) bool {
+	if _, ok := question.Answers[player]; ok {
+		return true
+	}
+	if player.team == nil {
+		return false
+	}
+	switch r.Settings.TeamAnswer {
+	case TeamAnswerFirst:
+		_, ok := r.teamAnswer(player.team, question)
+		return ok
+	case TeamAnswerCaptain:
+		_, ok := question.Answers[r.teamCaptain(player.team)]
+		return ok
+	}
+	return false
+}
+
+// teamAnswer picks the team's answer from its members' votes, see TeamAnswerMode.
+func (r *Room) teamAnswer(team *Team, question *Question) (int, bool) {
+	votes := []int{}
+	for _, player := range question.answerOrder {
+		if player.team == team {
+			votes = append(votes, question.Answers[player])
+		}
+	}
+	if len(votes) == 0 {
+		return 0, false
+	}
+
+	switch r.Settings.TeamAnswer {
+	case TeamAnswerFirst:
+		return votes[0], true
+	case TeamAnswerCaptain:
+		if vote, ok := question.Answers[r.teamCaptain(team)]; ok {
+			return vote, true
+		}
+	}
+	counts := make(map[int]int)
+	for _, vote := range votes {
+		counts[vote]++
+	}
+	best := votes[0]
+	for _, vote := range votes {
+		if counts[vote] > counts[best] {
+			best = vote
+		}
+	}
+	return best, true
+}
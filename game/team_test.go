@@ -0,0 +1,153 @@
+package game
+
+import "testing"
+
+func TestTeamAnswers(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  TeamAnswerMode
+		steps []step
+		// Expected player scores, not checked if nil
+		scores []int
+		// Expected team scores, and the players counted correct and incorrect
+		teamScores []int
+		correct    []int
+		incorrect  []int
+		errors     []string
+	}{
+		{
+			name:       "first vote answers for the team",
+			mode:       TeamAnswerFirst,
+			steps:      []step{start(0), vote(0, 0), vote(2, 1)},
+			teamScores: []int{2, 0},
+			correct:    []int{0},
+			incorrect:  []int{2},
+			errors:     []string{"", "", "", ""},
+		},
+		{
+			name:       "teammates can not vote after the first",
+			mode:       TeamAnswerFirst,
+			steps:      []step{start(0), vote(0, 0), vote(1, 1), vote(2, 1)},
+			teamScores: []int{2, 0},
+			correct:    []int{0},
+			incorrect:  []int{2},
+			errors:     []string{"", "team_answered", "", ""},
+		},
+		{
+			name:       "teammates answered for settle their stake with the team",
+			mode:       TeamAnswerFirst,
+			steps:      []step{finalWager(10), start(0), wager(0, 5), wager(1, 5), wager(2, 5), wager(3, 5), vote(0, 0), vote(2, 1)},
+			teamScores: []int{12, -10},
+			scores:     []int{18, 15, 5, 5},
+			correct:    []int{0},
+			incorrect:  []int{2},
+			errors:     []string{"", "", "", ""},
+		},
+		{
+			name:       "captain answers for the team",
+			mode:       TeamAnswerCaptain,
+			steps:      []step{start(0), vote(0, 0), vote(2, 1)},
+			teamScores: []int{2, 0},
+			correct:    []int{0},
+			incorrect:  []int{2},
+			errors:     []string{"", "", "", ""},
+		},
+		{
+			name:       "members disagreeing with the captain are incorrect",
+			mode:       TeamAnswerCaptain,
+			steps:      []step{start(0), vote(1, 1), vote(0, 0), vote(3, 0), vote(2, 1)},
+			teamScores: []int{2, 0},
+			correct:    []int{0},
+			incorrect:  []int{1, 3, 2},
+			errors:     []string{"", "", "", ""},
+		},
+		{
+			name:       "teams without an answer are incorrect",
+			mode:       TeamAnswerCaptain,
+			steps:      []step{start(0), vote(0, 0), timeUp()},
+			teamScores: []int{2, 0},
+			correct:    []int{0},
+			incorrect:  []int{2, 3},
+			errors:     []string{"", "", "", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, players := newTestRoom(t, 1, "a", "b", "c", "d")
+			r.Settings.TeamAnswer = tt.mode
+			r.Settings.Scoring = []string{StreakRule{}.Name()}
+			r.SetupTeams(2)
+			for i, player := range players {
+				player.team = r.Teams[i/2]
+				player.streak = 1
+			}
+			runSteps(r, players, tt.steps)
+
+			if r.Scene != SceneResults {
+				t.Errorf("scene = %d, want %d", r.Scene, SceneResults)
+			}
+			for i, team := range r.Teams {
+				if team.Score != tt.teamScores[i] {
+					t.Errorf("%s score = %d, want %d", team.Name, team.Score, tt.teamScores[i])
+				}
+			}
+			for i, player := range players {
+				if tt.scores != nil && player.Score != tt.scores[i] {
+					t.Errorf("%s score = %d, want %d", player.Name, player.Score, tt.scores[i])
+				}
+			}
+			question := r.Questions[0]
+			checkPlayers(t, "correct", players, question.CorrectPlayers, tt.correct)
+			checkPlayers(t, "incorrect", players, question.IncorrectPlayers, tt.incorrect)
+			for i, player := range players {
+				if code := lastError(player); code != tt.errors[i] {
+					t.Errorf("%s last error = %q, want %q", player.Name, code, tt.errors[i])
+				}
+				_, voted := question.Answers[player]
+				want := 0
+				switch {
+				case containsPlayerIndex(tt.correct, players, player):
+					want = 2
+				case !voted && !containsPlayerIndex(tt.incorrect, players, player):
+					// Answered for by the team, the streak is left alone
+					want = 1
+				}
+				if player.streak != want {
+					t.Errorf("%s streak = %d, want %d", player.Name, player.streak, want)
+				}
+			}
+		})
+	}
+}
+
+// checkPlayers reports an error unless got holds exactly the players at the indices in want.
+func checkPlayers(t *testing.T, what string, players []*Player, got []*Player, want []int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s players = %v, want %v", what, playerNames(got), want)
+		return
+	}
+	for _, i := range want {
+		if !containsPlayer(got, players[i]) {
+			t.Errorf("%s players = %v, want %s among them", what, playerNames(got), players[i].Name)
+		}
+	}
+}
+
+func containsPlayerIndex(indices []int, players []*Player, player *Player) bool {
+	for _, i := range indices {
+		if players[i] == player {
+			return true
+		}
+	}
+	return false
+}
+
+func playerNames(players []*Player) []string {
+	names := []string{}
+	for _, player := range players {
+		names = append(names, player.Name)
+	}
+	return names
+}
@@ -0,0 +1,103 @@
+package game
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Matches player placeholders such as {1} and {2} in question texts
+var placeholderRegexp = regexp.MustCompile(`\{(\d+)\}`)
+
+// RequiredTargets returns the number of distinct players needed to fill the question's placeholders.
+func (q *Question) RequiredTargets() int {
+	description, choices := q.templates()
+	required := requiredTargets(description)
+	for _, choice := range choices {
+		if n := requiredTargets(choice); n > required {
+			required = n
+		}
+	}
+	return required
+}
+
+// ApplyTargets fills the question's placeholders, {1} is replaced by the first target and so on.
+// The original texts are kept so the question can be templated again.
+func (q *Question) ApplyTargets(targets []*Player) {
+	description, choices := q.templates()
+	if q.rawChoices == nil {
+		q.rawDescription = description
+		q.rawChoices = choices
+	}
+
+	q.Targets = targets
+	q.Description = fillPlaceholders(description, targets)
+	q.Choices = make([]string, len(choices))
+	for i, choice := range choices {
+		q.Choices[i] = fillPlaceholders(choice, targets)
+	}
+}
+
+func (q *Question) templates() (string, []string) {
+	if q.rawChoices != nil {
+		return q.rawDescription, q.rawChoices
+	}
+	return q.Description, q.Choices
+}
+
+func requiredTargets(s string) int {
+	required := 0
+	for _, match := range placeholderRegexp.FindAllStringSubmatch(s, -1) {
+		if n, err := strconv.Atoi(match[1]); err == nil && n > required {
+			required = n
+		}
+	}
+	return required
+}
+
+func fillPlaceholders(s string, targets []*Player) string {
+	return placeholderRegexp.ReplaceAllStringFunc(s, func(placeholder string) string {
+		n, err := strconv.Atoi(placeholder[1 : len(placeholder)-1])
+		if err != nil || n < 1 || n > len(targets) {
+			return placeholder
+		}
+		return targets[n-1].Name
+	})
+}
+
+// pickTargets selects n distinct players, preferring those that have been targeted the least.
+func (r *Room) pickTargets(n int) []*Player {
+	if n > len(r.Players) {
+		return nil
+	}
+	players := make([]*Player, 0, len(r.Players))
+	for player := range r.Players {
+		players = append(players, player)
+	}
+	rand.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+	sort.SliceStable(players, func(i, j int) bool {
+		return r.targetCounts[players[i]] < r.targetCounts[players[j]]
+	})
+
+	targets := players[:n]
+	for _, target := range targets {
+		r.targetCounts[target]++
+	}
+	return targets
+}
+
+// prepareQuestion templates the question about to become current.
+// Returns false if there are not enough players to fill its placeholders.
+func (r *Room) prepareQuestion(q *Question) bool {
+	required := q.RequiredTargets()
+	if required == 0 {
+		return true
+	}
+	targets := r.pickTargets(required)
+	if targets == nil {
+		return false
+	}
+	q.ApplyTargets(targets)
+	return true
+}
@@ -0,0 +1,118 @@
+package game
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Time players have to place their stakes before a wager question is shown
+const WagerDuration = 20 * time.Second
+
+// isWager reports whether players stake points on the question before it is shown.
+func (q *Question) isWager() bool {
+	return q.Wager || q.finalWager
+}
+
+// maxStake returns the most the player can stake, all of their current score.
+func maxStake(player *Player) int {
+	if player.Score < 0 {
+		return 0
+	}
+	return player.Score
+}
+
+// toJSONWager builds the client view of a wager question while stakes are placed, only what
+// kind of question it is and who has placed their stake. viewer (if any) sees their own stake.
+func (q *Question) toJSONWager(viewer *Player) *JSONQuestion {
+	jsonQuestion := &JSONQuestion{Type: q.Type, Kind: q.Kind.String(), Choices: []string{}, Reward: q.Reward, Answers: []string{}, CorrectPlayers: []string{}, IncorrectPlayers: []string{}, Targets: []string{}, Wager: true, Wagered: []string{}}
+	for player := range q.Stakes {
+		jsonQuestion.Wagered = append(jsonQuestion.Wagered, player.Name)
+	}
+	if stake, ok := q.Stakes[viewer]; ok && viewer != nil {
+		jsonQuestion.Stake = &stake
+	}
+	return jsonQuestion
+}
+
+// WagerRule wins every player their stake if they answered correctly and loses it otherwise,
+// not answering included. Players their team answered for settle on the team's answer. A
+// team wins or loses the stakes of its members. It is applied to wager questions after the
+// other rules.
+type WagerRule struct{}
+
+func (WagerRule) Name() string { return "wager" }
+
+func (rule WagerRule) Score(s *Scoring) {
+	for player, stake := range s.Question.Stakes {
+		won := s.Correct(player)
+		if s.coveredByTeam[player] {
+			answer, ok := s.TeamAnswers[player.team]
+			won = ok && containsInt(s.Winners, answer)
+		}
+		if !won {
+			stake = -stake
+		}
+		s.Bonus(player, rule.Name(), stake)
+		if player.team != nil {
+			player.team.Score += stake
+		}
+	}
+}
+
+// showWager asks the players to stake points on the current question before it is shown.
+func (r *Room) showWager() {
+	r.Scene = SceneWager
+	r.Deadline = time.Now().Add(WagerDuration)
+	r.schedule(WagerDuration)
+	log.Debug().Msg("Room [" + r.ID + "]: Taking wagers for (" + r.Questions[r.CurrentQuestion].Description + ")")
+	r.broadcastScene()
+}
+
+// askQuestion moves on to the current question, taking wagers first if it is a wager question.
+func (r *Room) askQuestion() {
+	if r.Questions[r.CurrentQuestion].isWager() {
+		r.showWager()
+	} else {
+		r.startAnswering()
+	}
+}
+
+func (r *Room) handleWager(player *Player, amount int) error {
+	if !r.Players[player] {
+		return ErrUnknownPlayer
+	}
+	if r.Scene != SceneWager {
+		return ErrWrongScene
+	}
+	if player.Eliminated {
+		return ErrEliminated
+	}
+	question := r.Questions[r.CurrentQuestion]
+	if _, ok := question.Stakes[player]; ok {
+		return ErrAlreadyWagered
+	}
+	if amount < 0 || amount > maxStake(player) {
+		return ErrInvalidWager
+	}
+	if question.Stakes == nil {
+		question.Stakes = make(map[*Player]int)
+	}
+	question.Stakes[player] = amount
+	r.broadcast(MessagePlayerWagered, &PlayerWageredPayload{Name: player.Name})
+	if r.allWagered() {
+		r.startAnswering()
+	}
+	return nil
+}
+
+// allWagered reports whether every connected player still in the game has placed their stake.
+func (r *Room) allWagered() bool {
+	question := r.Questions[r.CurrentQuestion]
+	for player := range r.Players {
+		if _, ok := question.Stakes[player]; !ok && player.IsConnected() && !player.Eliminated {
+			return false
+		}
+	}
+	return true
+}